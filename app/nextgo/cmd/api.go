@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -15,8 +16,12 @@ import (
 )
 
 var (
-	src    string
-	output string
+	src               string
+	output            string
+	check             bool
+	strict            bool
+	diagnosticsFormat string
+	tags              []string
 )
 
 func init() {
@@ -25,6 +30,34 @@ func init() {
 
 	generateCmd.PersistentFlags().StringVar(&src, "src", "", "your api dir")
 	generateCmd.PersistentFlags().StringVar(&output, "out", "", "the output of generated code your api dir")
+	generateCmd.PersistentFlags().BoolVar(&check, "check", false, "print a diff and exit non-zero if the generated code is out of date, without writing")
+	addParseFlags(generateCmd)
+}
+
+func addParseFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringSliceVar(&tags, "tags", nil, "comma-separated list of build tags the api dir is loaded with")
+	cmd.PersistentFlags().BoolVar(&strict, "strict", false, "exit non-zero if the api dir has any error diagnostic")
+	cmd.PersistentFlags().StringVar(&diagnosticsFormat, "diagnostics-format", codegen2.DiagnosticsText, "the format of diagnostics written to stderr, text or json")
+}
+
+// parseApi parses the api dir and writes the diagnostics found to stderr, it
+// exits on errors that stop generation, and on any error in strict mode
+func parseApi(dir string) *codegen2.RestfulApi {
+	apis, diags, err := codegen2.Parse(dir, tags...)
+	if werr := diags.Write(os.Stderr, diagnosticsFormat); werr != nil {
+		log.Fatalln(werr)
+	}
+	if err != nil {
+		var d codegen2.Diagnostic
+		if !errors.As(err, &d) {
+			log.Fatalln(err)
+		}
+		os.Exit(1)
+	}
+	if strict && diags.HasErrors() {
+		os.Exit(1)
+	}
+	return apis
 }
 
 var apiCmd = &cobra.Command{
@@ -67,14 +100,16 @@ func runGenerate(cmd *cobra.Command, args []string) {
 	output = filepath.Join(output, filepath.Base(src))
 	modNamePrefix := filepath.Join(modName, strings.TrimPrefix(output, projectDir))
 
-	apis, err := codegen2.Parse(src)
-	if err != nil {
-		log.Fatalln(err)
-	}
+	apis := parseApi(src)
 
-	fmt.Println(codegen2.Beautify(apis.Apis))
+	opts := []codegen2.GenerateOptionFunc{codegen2.WithBuildTags(tags...), codegen2.WithLog(os.Stderr)}
+	if check {
+		opts = append(opts, codegen2.WithCheck(os.Stdout))
+	} else {
+		fmt.Println(codegen2.Beautify(apis.Apis))
+	}
 
-	if err := codegen2.Generate(src, output, modNamePrefix, apis); err != nil {
+	if err := codegen2.Generate(src, output, modNamePrefix, apis, opts...); err != nil {
 		log.Fatalln(err)
 	}
 }
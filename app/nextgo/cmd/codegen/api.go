@@ -1,7 +1,6 @@
 package codegen
 
 import (
-	"fmt"
 	"go/token"
 	"go/types"
 	"net/http"
@@ -10,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/go-openapi/spec"
+	"github.com/samber/lo"
 )
 
 // Type
@@ -53,8 +53,14 @@ type Mapping struct {
 	Middleware []string
 	HttpCode   int
 	PathPrefix bool
+	// Ignore excludes the next function from code generation
+	Ignore     bool
 	BindQuery  []Type
 	BindHeader []Type
+	BindCookie []Type
+	BindForm   []Type
+	// PathParams holds the path parameters declared with PathParam
+	PathParams []PathParam
 
 	// expr line in file, value from pos
 	line int
@@ -66,15 +72,249 @@ type Arg struct {
 	Name string
 	Desc string
 	Star bool
+	// Slice is true for []T and []*T
+	Slice bool
 	// packageName.TypeName
 	Type Type
 	// Location 参数位置
 	Location    string
 	ObjectTypes types.Object
 	Package     PackageItem
+	// GoType is the resolved type of the arg
+	GoType types.Type `json:"-"`
+	// Imports holds the packages referenced by composite and generic types
+	Imports []PackageItem
 
-	//
+	// elemType is GoType without the pointer and slice described by Star and Slice
+	elemType types.Type
+	// Provider supplies the arg, see nextgo.Provide
+	Provider *Provider
+
+	// PathParamName is the name of the path segment the arg is decoded from
 	PathParamName string
+	// FormField is the form field a file arg is decoded from
+	FormField string
+}
+
+// PathParam is a path parameter declared with Mapping.PathParam, the raw value
+// must match Pattern, Format is the swagger format of named constraints
+type PathParam struct {
+	Name string
+	// Arg is the handler arg decoded from the parameter, empty for the arg named Name
+	Arg     string
+	Format  string
+	Pattern string
+	// VarName names the compiled pattern in the generated handler
+	VarName string
+
+	pos token.Position
+	// inherited is true for parameters declared by middleware.go of a parent directory
+	inherited bool
+}
+
+// pathConstraints are the named constraints accepted by Mapping.PathParam,
+// other constraints are regular expressions starting with ^
+var pathConstraints = map[string]PathParam{
+	"uuid":  {Format: "uuid", Pattern: `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`},
+	"date":  {Format: "date", Pattern: `^[0-9]{4}-[0-9]{2}-[0-9]{2}$`},
+	"int":   {Pattern: `^-?[0-9]+$`},
+	"uint":  {Pattern: `^[0-9]+$`},
+	"alpha": {Pattern: `^[a-zA-Z]+$`},
+	"alnum": {Pattern: `^[a-zA-Z0-9]+$`},
+	"slug":  {Pattern: `^[a-z0-9]+(-[a-z0-9]+)*$`},
+}
+
+// Provider is a function declared with nextgo.Provide, supplying the handler
+// args of its result type in the directory of the declaration and below
+type Provider struct {
+	Func    string
+	Package PackageItem
+	// Param is the type of the provider param, empty, context.Context or *net/http.Request
+	Param string
+	// Err is true for providers returning (T, error)
+	Err bool
+	// Type is the provided type
+	Type types.Type `json:"-"`
+
+	pos token.Position
+}
+
+// CallExpr returns the expression calling the provider in generated handlers
+func (p Provider) CallExpr() string {
+	pkg := p.Package.Name
+	if p.Package.Alias != "" {
+		pkg = p.Package.Alias
+	}
+	switch p.Param {
+	case "context.Context":
+		return pkg + "." + p.Func + "(req.Context())"
+	case "*net/http.Request":
+		return pkg + "." + p.Func + "(req)"
+	}
+	return pkg + "." + p.Func + "()"
+}
+
+// TypeExpr returns the Go type expression of the arg, e.g. []*multipart.FileHeader
+func (a Arg) TypeExpr() string {
+	expr := a.Type.PackageName
+	if a.Star {
+		expr = "*" + expr
+	}
+	if a.Slice {
+		expr = "[]" + expr
+	}
+	return expr
+}
+
+// ValueTypeExpr returns the type expression of the decoded value, the pointer
+// of a non slice arg is described by Star
+func (a Arg) ValueTypeExpr() string {
+	if a.Slice {
+		return a.TypeExpr()
+	}
+	return a.Type.PackageName
+}
+
+// ZeroExpr returns the expression of the zero decoded value, e.g. todos.Item{} or *new(int)
+func (a Arg) ZeroExpr() string {
+	if a.Slice || a.IsComposite() || a.IsStruct() {
+		return a.ValueTypeExpr() + "{}"
+	}
+	return "*new(" + a.ValueTypeExpr() + ")"
+}
+
+// IsComposite reports whether the arg is a map, an array, a nested slice or an
+// instantiated generic type, rendered from go/types
+func (a Arg) IsComposite() bool {
+	return a.Type.Kind == compositeKind
+}
+
+// IsStruct reports whether the decoded value is a struct, only structs are validated
+func (a Arg) IsStruct() bool {
+	if a.Slice || a.elemType == nil {
+		return !a.Slice && !a.IsComposite()
+	}
+	_, ok := a.elemType.Underlying().(*types.Struct)
+	return ok
+}
+
+// IsFile reports whether the arg is an uploaded multipart file
+func (a Arg) IsFile() bool {
+	return a.Type.FullName == fileHeaderFullName
+}
+
+const fileHeaderFullName = "mime/multipart.FileHeader"
+
+// compositeKind is the Type.Kind of types rendered from go/types
+const compositeKind = "composite"
+
+// IsOptionalBody reports whether the arg is a pointer body, left nil when the request has no body
+func (a Arg) IsOptionalBody() bool {
+	return a.Location == "body" && a.Star && !a.Slice
+}
+
+// PassByAddress reports whether the arg is a pointer decoded into a value,
+// the handler gets the address of the value
+func (a Arg) PassByAddress() bool {
+	switch a.Location {
+	case "path", "query", "header", "cookie", "form":
+		return a.Star && !a.Slice
+	}
+	return false
+}
+
+// ResponseBody returns the result encoded into the response body, at most one
+func (h HandleFunc) ResponseBody() []Arg {
+	var body []Arg
+	for i, a := range h.ResponseResult {
+		if a.Type.FullName != "error" && (i != 0 || h.StatusResult() == nil) {
+			body = append(body, a)
+		}
+	}
+	return body
+}
+
+// StatusResult returns the int status code result of (int, T, error) handlers
+func (h HandleFunc) StatusResult() *Arg {
+	if len(h.ResponseResult) == 3 {
+		return &h.ResponseResult[0]
+	}
+	return nil
+}
+
+// GeneratedName returns the name of the generated handler func without the
+// HandleFunc suffix, methods are prefixed with their service type
+func (h HandleFunc) GeneratedName() string {
+	if h.Service != nil {
+		return h.Service.Name + h.Name
+	}
+	return h.Name
+}
+
+// FuncName returns the name of the handler as printed by runtime.FuncForPC, e.g.
+// example.com/api/v1/todos.UpdateTodo or example.com/api/v1/notes.(*NoteService).Get
+func (h HandleFunc) FuncName() string {
+	if h.Service == nil {
+		return h.HandlerPackage.Path + "." + h.Name
+	}
+	if h.Service.Star {
+		return h.HandlerPackage.Path + ".(*" + h.Service.Name + ")." + h.Name
+	}
+	return h.HandlerPackage.Path + "." + h.Service.Name + "." + h.Name
+}
+
+// isReservedName reports whether name is taken in generated handlers, by the
+// template or by the handler package
+func isReservedName(name, packageName string) bool {
+	switch name {
+	case "_", "chain", "opt", "routeInfo", "tracer", "span", "handleFunc", "rw", "req", "err", packageName:
+		return true
+	}
+	return false
+}
+
+// shadowsTemplateName reports whether the arg would shadow a name of the
+// generated handler, the *http.Request req and the http.ResponseWriter rw are
+// the ones of the handler
+func (a Arg) shadowsTemplateName(packageName string) bool {
+	switch {
+	case a.Name == "req" && a.Type.FullName == "net/http.Request",
+		a.Name == "rw" && a.Type.FullName == "net/http.ResponseWriter":
+		return false
+	}
+	return a.Name != "_" && isReservedName(a.Name, packageName)
+}
+
+// ContextArg returns the name of the context.Context arg, empty if the handler takes none
+func (h HandleFunc) ContextArg() string {
+	for _, a := range h.RequestArgs {
+		if a.Type.FullName == "context.Context" {
+			return a.Name
+		}
+	}
+	return ""
+}
+
+// HasResponseWriter reports whether the handler writes the response itself
+func (h HandleFunc) HasResponseWriter() bool {
+	for _, a := range h.RequestArgs {
+		if a.Type.FullName == "net/http.ResponseWriter" {
+			return true
+		}
+	}
+	return false
+}
+
+// SuccessStatusCode returns the status code of a successful response,
+// Mapping.StatusCode first, otherwise 200 or 204 for handlers without body
+func (h HandleFunc) SuccessStatusCode() int {
+	if h.With != nil && h.With.HttpCode != 0 {
+		return h.With.HttpCode
+	}
+	if len(h.ResponseBody()) == 0 {
+		return http.StatusNoContent
+	}
+	return http.StatusOK
 }
 
 type HandleFunc struct {
@@ -85,22 +325,34 @@ type HandleFunc struct {
 	ResponseError  bool
 	With           *Mapping
 	WithGlobal     *Mapping
+	// Service is the receiver type of method handlers, nil for functions
+	Service *Type
+	// Receiver names the service instance in the generated handler
+	Receiver string
 
 	Imports     []PackageItem
 	Patten      string
 	PackageName string
+	// HandlerPackage is the package declaring the handler
+	HandlerPackage PackageItem
 
 	RouteInfoPackage  PackageItem
 	AliceChainPackage PackageItem
 	GoHttpPackage     PackageItem
 
 	ParentMiddlewares []string
+	// ParentPathParams are declared by MappingFile in middleware.go of the directory and above, nearest last
+	ParentPathParams []PathParam
+	// PathParams are the path parameters of the route, resolved from the mappings
+	PathParams []PathParam
 	// Middlewares
 	Middlewares []string
 	Pos         token.Position
 
 	// help for generate code
 	GeneratedPackageInfo PackageItem
+	// PathPatterns are the path parameter constraints checked by the generated handler
+	PathPatterns []PathParam
 
 	mappingMerged bool
 }
@@ -117,12 +369,15 @@ func (h *HandleFunc) mergeMapping() {
 	h.mappingMerged = true
 
 	if h.WithGlobal == nil {
+		h.Middlewares = resolveIncludeExclude(append(h.ParentMiddlewares, h.With.Middleware...))
 		return
 	}
 
 	h.With.Middleware = append(h.WithGlobal.Middleware, h.With.Middleware...)
 	h.With.BindQuery = append(h.WithGlobal.BindQuery, h.With.BindQuery...)
 	h.With.BindHeader = append(h.WithGlobal.BindHeader, h.With.BindHeader...)
+	h.With.BindCookie = append(h.WithGlobal.BindCookie, h.With.BindCookie...)
+	h.With.BindForm = append(h.WithGlobal.BindForm, h.With.BindForm...)
 	l := map[string]string{}
 	for k, v := range h.WithGlobal.Label {
 		l[k] = v
@@ -135,9 +390,163 @@ func (h *HandleFunc) mergeMapping() {
 	return
 }
 
+// isRequestArg reports whether the arg is taken from the request directly
+func isRequestArg(a Arg) bool {
+	switch a.Type.FullName {
+	case "context.Context", "net/http.Request", "net/http.ResponseWriter":
+		return true
+	}
+	return false
+}
+
+// argLocation returns where the arg is decoded from, empty for args taken from
+// the request directly, such as context.Context and *http.Request
+func (h HandleFunc) argLocation(a Arg) string {
+
+	if isRequestArg(a) {
+		return ""
+	}
+	if a.Provider != nil {
+		return "provider"
+	}
+
+	if a.IsFile() {
+		return "file"
+	}
+	if _, ok := lo.Find(h.With.BindForm, func(item Type) bool { return item.EqualTo(a.Type) }); ok {
+		return "form"
+	}
+	if _, ok := lo.Find(h.With.BindQuery, func(item Type) bool { return item.EqualTo(a.Type) }); ok {
+		return "query"
+	}
+	if _, ok := lo.Find(h.With.BindHeader, func(item Type) bool { return item.EqualTo(a.Type) }); ok {
+		return "header"
+	}
+	if _, ok := lo.Find(h.With.BindCookie, func(item Type) bool { return item.EqualTo(a.Type) }); ok {
+		return "cookie"
+	}
+	if a.PathParamName != "" && isPathType(a) {
+		return "path"
+	}
+	if a.Type.IsPrimitive() && !a.Slice {
+		return "path"
+	}
+	return "body"
+}
+
+// pathParamName returns the name of the route segment decoded into the arg,
+// empty if the route has no such segment
+func (h HandleFunc) pathParamName(a Arg) string {
+	name := a.Name
+	for _, p := range h.PathParams {
+		if p.Arg == a.Name {
+			name = p.Name
+			break
+		}
+	}
+	if p := h.pathParam(name); p != nil && p.Arg != "" && p.Arg != a.Name {
+		// the segment is decoded into another arg
+		return ""
+	}
+	if slices.Contains(h.PathParamNames(), name) {
+		return name
+	}
+	return ""
+}
+
+// PathParamNames returns the names of the path parameters of the route in order
+func (h HandleFunc) PathParamNames() []string {
+	var names []string
+	for _, s := range strings.Split(h.Patten, "/") {
+		if isPathParam(s) {
+			names = append(names, strings.TrimSuffix(strings.Trim(s, "{}"), "..."))
+		}
+	}
+	return names
+}
+
+// pathParam returns the path parameter name declared with PathParam, nil if none
+func (h HandleFunc) pathParam(name string) *PathParam {
+	for i, p := range h.PathParams {
+		if p.Name == name {
+			return &h.PathParams[i]
+		}
+	}
+	return nil
+}
+
+// resolvePathParams merges the path parameters of middleware.go files, the
+// MappingFile and the Mapping of the handler, the nearest declaration of the
+// arg and of the constraint wins
+func resolvePathParams(h HandleFunc) []PathParam {
+
+	var declared []PathParam
+	for _, p := range h.ParentPathParams {
+		p.inherited = true
+		if !slices.ContainsFunc(h.RequestArgs, func(a Arg) bool { return a.Name == p.Arg }) {
+			p.Arg = ""
+		}
+		declared = append(declared, p)
+	}
+	for _, m := range []*Mapping{h.WithGlobal, h.With} {
+		if m != nil {
+			declared = append(declared, m.PathParams...)
+		}
+	}
+
+	var params []PathParam
+	for _, p := range declared {
+		i := slices.IndexFunc(params, func(prev PathParam) bool { return prev.Name == p.Name })
+		if i < 0 {
+			params = append(params, p)
+			continue
+		}
+		if p.Arg != "" {
+			params[i].Arg = p.Arg
+		}
+		if p.Pattern != "" {
+			params[i].Format, params[i].Pattern = p.Format, p.Pattern
+		}
+		params[i].pos, params[i].inherited = p.pos, p.inherited
+	}
+	return params
+}
+
+// isPathType reports whether a path segment can be decoded into the arg, that
+// is a primitive, a type based on one, or an encoding.TextUnmarshaler
+func isPathType(a Arg) bool {
+	if a.Slice {
+		return false
+	}
+	if a.Type.IsPrimitive() {
+		return true
+	}
+	if a.elemType == nil {
+		return false
+	}
+	if _, ok := a.elemType.Underlying().(*types.Basic); ok {
+		return true
+	}
+	return isTextUnmarshaler(a.elemType)
+}
+
+// isTextUnmarshaler reports whether *t implements encoding.TextUnmarshaler
+func isTextUnmarshaler(t types.Type) bool {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), false, nil, "UnmarshalText")
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return false
+	}
+	sig := fn.Type().(*types.Signature)
+	return sig.Params().Len() == 1 && sig.Results().Len() == 1 && types.Identical(sig.Params().At(0).Type(), types.NewSlice(types.Typ[types.Byte]))
+}
+
 type RestfulApi struct {
 	Apis    map[string]map[string]HandleFunc
 	Schemas map[string]spec.Schema
+	Fields  map[string]map[string]SchemaField `json:"-"`
+	// Diagnostics found while building routes, e.g. ambiguous patterns
+	Diagnostics Diagnostics `json:"-"`
 }
 
 func BuildRestfulApi(prefix string, api API) (*RestfulApi, error) {
@@ -146,6 +555,7 @@ func BuildRestfulApi(prefix string, api API) (*RestfulApi, error) {
 	if err != nil {
 		return nil, err
 	}
+	diags := bindProviders(handlers, api.Providers)
 
 	apis := make(map[string]map[string]HandleFunc)
 
@@ -153,7 +563,6 @@ func BuildRestfulApi(prefix string, api API) (*RestfulApi, error) {
 		if h.With == nil {
 			h.With = &Mapping{
 				HttpMethod: http.MethodGet,
-				HttpCode:   http.StatusOK,
 			}
 		}
 
@@ -161,14 +570,21 @@ func BuildRestfulApi(prefix string, api API) (*RestfulApi, error) {
 		method := h.With.HttpMethod
 		if method == "" {
 			method = http.MethodGet
+			h.With.HttpMethod = method
 		}
 
+		h.PathParams = resolvePathParams(h)
+
 		path := getApiPath(prefix, h.Pos.Filename)
 		ss := strings.Split(path, "/")
 	L1:
 		for i, s := range ss {
+			if p := h.pathParam(s); p != nil && p.Arg != "" {
+				ss[i] = "{" + s + "}"
+				continue
+			}
 			for _, a := range h.RequestArgs {
-				if a.Name == s {
+				if a.Name == s && !slices.ContainsFunc(h.PathParams, func(p PathParam) bool { return p.Arg == a.Name }) {
 					ss[i] = "{" + a.Name + "}"
 					continue L1
 				}
@@ -179,14 +595,159 @@ func BuildRestfulApi(prefix string, api API) (*RestfulApi, error) {
 			apis[path] = make(map[string]HandleFunc)
 		}
 		h.Patten = path
+		h.RequestArgs = slices.Clone(h.RequestArgs)
+		for k, a := range h.RequestArgs {
+			h.RequestArgs[k].PathParamName = h.pathParamName(a)
+		}
+		diags = append(diags, checkPathParams(h)...)
+		if prev, ok := apis[path][method]; ok {
+			return nil, newDiagnostic(h.Pos, SeverityError, CodeDuplicateRoute,
+				"duplicate route %s %s: %s is already served by %s at %s", method, path, h.Name, prev.Name, prev.Pos)
+		}
 		apis[path][method] = h
 
 	}
 
-	ret := &RestfulApi{Apis: apis, Schemas: api.Schemas}
+	ret := &RestfulApi{Apis: apis, Schemas: api.Schemas, Fields: api.Fields}
+	ret.Diagnostics = append(diags, checkAmbiguousRoutes(apis)...)
 	return ret, nil
 }
 
+// checkPathParams reports path parameters declared for the handler naming no
+// segment of the route or no handler arg, or a segment decoded into an arg that
+// isn't a path parameter. Parameters of middleware.go only apply where they fit.
+func checkPathParams(h HandleFunc) Diagnostics {
+
+	var diags Diagnostics
+	for _, p := range h.PathParams {
+		if !slices.Contains(h.PathParamNames(), p.Name) {
+			if !p.inherited {
+				diags = append(diags, newDiagnostic(p.pos, SeverityError, CodeInvalidMapping,
+					"path parameter %s of %s not found in route %s", p.Name, h.Name, h.Patten))
+			}
+			continue
+		}
+		if p.Arg != "" && !p.inherited && !slices.ContainsFunc(h.RequestArgs, func(a Arg) bool { return a.Name == p.Arg }) {
+			diags = append(diags, newDiagnostic(p.pos, SeverityError, CodeInvalidMapping,
+				"path parameter %s of %s is bound to %s, but %s has no such arg", p.Name, h.Name, p.Arg, h.Name))
+			continue
+		}
+		for _, a := range h.RequestArgs {
+			if a.PathParamName == p.Name && h.argLocation(a) != "path" {
+				diags = append(diags, newDiagnostic(p.pos, SeverityError, CodeInvalidMapping,
+					"path parameter %s of %s is decoded into %s %s, expect a string, a number or an encoding.TextUnmarshaler", p.Name, h.Name, a.Name, a.TypeExpr()))
+			}
+		}
+	}
+	return diags
+}
+
+// checkAmbiguousRoutes reports routes of the same method that match the same
+// requests, e.g. /todos/{id} and /todos/{todoId}, or whose match depends on
+// the registration order, e.g. /todos/search and /todos/{id}.
+func checkAmbiguousRoutes(apis map[string]map[string]HandleFunc) Diagnostics {
+
+	var routes []HandleFunc
+	for _, methods := range apis {
+		for _, h := range methods {
+			if !h.With.PathPrefix {
+				routes = append(routes, h)
+			}
+		}
+	}
+	slices.SortFunc(routes, func(a, b HandleFunc) int {
+		return strings.Compare(a.Patten+" "+a.With.HttpMethod, b.Patten+" "+b.With.HttpMethod)
+	})
+
+	var warnings Diagnostics
+	for i, a := range routes {
+		for _, b := range routes[i+1:] {
+			if routeMethod(a) != routeMethod(b) {
+				continue
+			}
+			as, bs := strings.Split(a.Patten, "/"), strings.Split(b.Patten, "/")
+			if len(as) != len(bs) {
+				continue
+			}
+
+			overlap, aSpecific, bSpecific := true, true, true
+			for k := range as {
+				ap, bp := isPathParam(as[k]), isPathParam(bs[k])
+				switch {
+				case !ap && !bp && as[k] != bs[k]:
+					overlap = false
+				case ap && !bp:
+					aSpecific = false
+				case !ap && bp:
+					bSpecific = false
+				}
+			}
+
+			var reason string
+			switch {
+			case !overlap:
+				continue
+			case aSpecific && bSpecific:
+				reason = "path parameters with different names match the same requests"
+			case aSpecific || bSpecific:
+				reason = "static segment is shadowed by a path parameter in routers matching in registration order"
+			default:
+				reason = "neither route is more specific, routers like http.ServeMux reject them"
+			}
+			warnings = append(warnings, newDiagnostic(b.Pos, SeverityWarning, CodeAmbiguousRoute,
+				"ambiguous routes %s %s and %s (%s): %s", routeMethod(a), b.Patten, a.Patten, a.Pos, reason))
+		}
+	}
+	return warnings
+}
+
+func routeMethod(h HandleFunc) string {
+	if h.With.HttpMethod == "" {
+		return http.MethodGet
+	}
+	return h.With.HttpMethod
+}
+
+func isPathParam(segment string) bool {
+	return strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}")
+}
+
+// bindProviders sets the provider of handler args, the provider declared in the
+// nearest directory of the handler wins
+func bindProviders(handlers []HandleFunc, providers []Provider) Diagnostics {
+
+	var diags Diagnostics
+	for i, p := range providers {
+		for _, prev := range providers[:i] {
+			if filepath.Dir(prev.pos.Filename) == filepath.Dir(p.pos.Filename) && types.Identical(prev.Type, p.Type) {
+				diags = append(diags, newDiagnostic(p.pos, SeverityError, CodeInvalidMapping,
+					"provider %s.%s of %s is already declared by %s.%s at %s", p.Package.Name, p.Func, p.Type, prev.Package.Name, prev.Func, prev.pos))
+			}
+		}
+	}
+
+	for i, h := range handlers {
+		dir := filepath.Dir(h.Pos.Filename)
+		for k, a := range h.RequestArgs {
+			if a.GoType == nil || isRequestArg(a) {
+				continue
+			}
+			var found *Provider
+			for j, p := range providers {
+				pdir := filepath.Dir(p.pos.Filename)
+				if dir != pdir && !strings.HasPrefix(dir, pdir+string(filepath.Separator)) {
+					continue
+				}
+				if types.Identical(p.Type, a.GoType) && (found == nil || len(pdir) > len(filepath.Dir(found.pos.Filename))) {
+					found = &providers[j]
+				}
+			}
+			handlers[i].RequestArgs[k].Provider = found
+		}
+	}
+	return diags
+}
+
 func BindMiddlewareFile(annotation []Mapping) []Mapping {
 
 	var middlewareFile []Mapping
@@ -220,7 +781,7 @@ func bindHandleFuncMapping(handlers []HandleFunc, annotations []Mapping) ([]Hand
 			nodeMap[v.pos.Filename] = append(nodeMap[v.pos.Filename], &node{Mapping: &annotations[k]})
 		} else {
 			if len(globalMapping[v.pos.Filename]) > 0 {
-				return nil, fmt.Errorf("multiple GlobalMapping found %s:%d", v.pos.Filename, v.pos.Line)
+				return nil, newDiagnostic(v.pos, SeverityError, CodeInvalidMapping, "multiple MappingFile found in %s", v.pos.Filename)
 			}
 			globalMapping[v.pos.Filename] = append(globalMapping[v.pos.Filename], annotations[k])
 		}
@@ -234,8 +795,8 @@ func bindHandleFuncMapping(handlers []HandleFunc, annotations []Mapping) ([]Hand
 		for i := 0; i < len(fileNodes)-1; i++ {
 			if fileNodes[i].Mapping != nil {
 				if n := fileNodes[i+1]; n.Mapping != nil {
-					return nil, fmt.Errorf("multiple annotations found %s:%d",
-						n.Pos().Filename, n.Pos().Line)
+					return nil, newDiagnostic(n.Pos(), SeverityError, CodeInvalidMapping,
+						"multiple Mapping found before a handler, previous one at %s", fileNodes[i].Pos())
 				} else {
 					fileNodes[i+1].HandleFunc.With = fileNodes[i].Mapping
 				}
@@ -244,6 +805,10 @@ func bindHandleFuncMapping(handlers []HandleFunc, annotations []Mapping) ([]Hand
 	}
 
 	middlewareFile := BindMiddlewareFile(annotations)
+	byDepth := slices.Clone(middlewareFile)
+	slices.SortStableFunc(byDepth, func(a, b Mapping) int {
+		return len(filepath.Dir(a.pos.Filename)) - len(filepath.Dir(b.pos.Filename))
+	})
 	for k, v := range handlers {
 		for _, m := range middlewareFile {
 			dir, _ := filepath.Split(m.pos.Filename)
@@ -251,6 +816,12 @@ func bindHandleFuncMapping(handlers []HandleFunc, annotations []Mapping) ([]Hand
 				handlers[k].ParentMiddlewares = append(handlers[k].ParentMiddlewares, m.Middleware...)
 			}
 		}
+		for _, m := range byDepth {
+			dir, _ := filepath.Split(m.pos.Filename)
+			if strings.HasPrefix(v.Pos.Filename, dir) {
+				handlers[k].ParentPathParams = append(handlers[k].ParentPathParams, m.PathParams...)
+			}
+		}
 		if m, ok := globalMapping[v.Pos.Filename]; ok {
 			handlers[k].WithGlobal = &m[0]
 		}
@@ -259,8 +830,85 @@ func bindHandleFuncMapping(handlers []HandleFunc, annotations []Mapping) ([]Hand
 	return handlers, nil
 }
 
+// getApiPath converts the handler file name to the route path, following the
+// Next.js conventions:
+//
+//	index.go     -> the directory itself
+//	[id]         -> {id}
+//	[...rest]    -> {rest...}, catch-all, must be the last segment
+//	(group)      -> no path segment, only organises code
+//
+// Go rejects brackets and parentheses in import paths and at the start of file
+// names, and "..." is a package pattern wildcard, so directories spell them as
+// id_, rest__ and group___, see routeDirName. Files keep matching path
+// parameters by handler arg name, see BuildRestfulApi.
 func getApiPath(prefix, str string) string {
 	str = strings.TrimPrefix(str, prefix)
 	str = strings.TrimSuffix(str, ".go")
+
+	ss := strings.Split(filepath.ToSlash(str), "/")
+	segments := make([]string, 0, len(ss))
+	for i, s := range ss {
+		if i == len(ss)-1 && s == "index" {
+			continue
+		}
+		if i < len(ss)-1 {
+			s = routeDirName(s)
+		}
+
+		switch {
+		case strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")"):
+			continue
+		case strings.HasPrefix(s, "[...") && strings.HasSuffix(s, "]"):
+			s = "{" + strings.TrimSuffix(strings.TrimPrefix(s, "[..."), "]") + "...}"
+		case strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]"):
+			s = "{" + strings.TrimSuffix(strings.TrimPrefix(s, "["), "]") + "}"
+		}
+		segments = append(segments, s)
+	}
+
+	str = strings.Join(segments, "/")
+	if !strings.HasPrefix(str, "/") {
+		str = "/" + str
+	}
 	return str
 }
+
+// routeDirName returns the Next.js spelling of a directory of the api tree:
+//
+//	id_       -> [id]
+//	rest__    -> [...rest]
+//	group___  -> (group)
+//
+// The leading spellings _id, __rest and _group_ are accepted as well, but the
+// go tool ignores directories starting with _, e.g. go vet ./... skips them.
+func routeDirName(s string) string {
+	name := strings.Trim(s, "_")
+	if name == "" {
+		return s
+	}
+	switch {
+	case strings.HasPrefix(s, "_") && strings.HasSuffix(s, "_"), strings.HasSuffix(s, "___"):
+		return "(" + name + ")"
+	case strings.HasPrefix(s, "__"), strings.HasSuffix(s, "__"):
+		return "[..." + name + "]"
+	case strings.HasPrefix(s, "_"), strings.HasSuffix(s, "_"):
+		return "[" + name + "]"
+	}
+	return s
+}
+
+// generatedDirName returns the directory of the generated package mirroring
+// the api tree directory s, spelled so that the go tool doesn't ignore it
+func generatedDirName(s string) string {
+	name := routeDirName(s)
+	switch {
+	case strings.HasPrefix(name, "(") && strings.HasSuffix(name, ")"):
+		return strings.Trim(name, "()") + "___"
+	case strings.HasPrefix(name, "[...") && strings.HasSuffix(name, "]"):
+		return strings.TrimSuffix(strings.TrimPrefix(name, "[..."), "]") + "__"
+	case strings.HasPrefix(name, "[") && strings.HasSuffix(name, "]"):
+		return strings.Trim(name, "[]") + "_"
+	}
+	return s
+}
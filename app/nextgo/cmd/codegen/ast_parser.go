@@ -2,15 +2,17 @@ package codegen
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
-	"log"
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -83,7 +85,17 @@ func (n *node) Pos() token.Position {
 type API struct {
 	Handlers    []HandleFunc
 	Annotations []Mapping
+	Providers   []Provider
 	Schemas     map[string]spec.Schema
+	// Fields of the schemas by type and property name
+	Fields map[string]map[string]SchemaField
+}
+
+// SchemaField is the struct field of a schema property, Tags holds the names
+// the codec decodes it from, e.g. by the cookie or form tag
+type SchemaField struct {
+	Name string
+	Tags map[string]string
 }
 
 type Parser struct {
@@ -91,9 +103,19 @@ type Parser struct {
 	fset     *token.FileSet
 	objCache *ObjectCache
 	api      *API
-	errs     []error
+	diags    Diagnostics
+
+	// pending is the last Mapping annotation not yet bound to a handler
+	pending *Mapping
+	// services are the types designated by nextgo.Service in the package, by name
+	services map[string]Type
+	// provided holds the full names of the functions passed to nextgo.Provide
+	provided map[string]bool
 }
 
+// ignoreDirective excludes the function it documents from code generation
+const ignoreDirective = "//nextgo:ignore"
+
 // parseMappingWith 解析 mapping.Mapping() 调用
 func (p *Parser) parseMappingWith(node *ast.GenDecl) error {
 
@@ -105,10 +127,17 @@ func (p *Parser) parseMappingWith(node *ast.GenDecl) error {
 		switch n := spec.(type) {
 		case *ast.ValueSpec:
 			for _, v := range n.Values {
+				if call, ok := p.nextgoCall(v, "Provide"); ok {
+					p.parseProviders(call.Args)
+					continue
+				}
 				with := Mapping{}
 				with.pos = p.fset.Position(v.Pos())
 				p.parseMappingWithCallExpr(v, &with)
-				if with.Scope != "" {
+				if with.Scope == "Mapping" {
+					p.pending = &with
+				}
+				if with.Scope != "" && !with.Ignore {
 					p.api.Annotations = append(p.api.Annotations, with)
 				}
 			}
@@ -126,6 +155,69 @@ func (p *Parser) isMappingWithCallExpr(sel *ast.SelectorExpr) bool {
 	return false
 }
 
+// nextgoCall returns expr as a call of the nextgo function name, e.g. nextgo.Service(T{})
+func (p *Parser) nextgoCall(expr ast.Expr, name string) (*ast.CallExpr, bool) {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok {
+		return nil, false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name || !p.isMappingWithCallExpr(sel) {
+		return nil, false
+	}
+	return call, true
+}
+
+// parseProviders parses the functions of nextgo.Provide(f...)
+func (p *Parser) parseProviders(args []ast.Expr) {
+
+	for _, arg := range args {
+		var ident *ast.Ident
+		switch t := arg.(type) {
+		case *ast.Ident:
+			ident = t
+		case *ast.SelectorExpr:
+			ident = t.Sel
+		}
+
+		var fn *types.Func
+		if ident != nil {
+			fn, _ = p.objCache.ObjectOf(ident).(*types.Func)
+		}
+		if fn == nil || fn.Pkg() == nil {
+			p.AddErr(arg, CodeInvalidMapping, "unexpected Provide arg: %v, must be a package level function", arg)
+			continue
+		}
+
+		sig := fn.Type().(*types.Signature)
+		provider := Provider{
+			Func:    fn.Name(),
+			Package: PackageItem{Name: fn.Pkg().Name(), Path: fn.Pkg().Path()},
+			pos:     p.fset.Position(arg.Pos()),
+		}
+
+		valid := sig.Recv() == nil && sig.TypeParams().Len() == 0 && sig.Params().Len() <= 1 && !sig.Variadic()
+		if valid && sig.Params().Len() == 1 {
+			provider.Param = types.TypeString(sig.Params().At(0).Type(), nil)
+			valid = provider.Param == "context.Context" || provider.Param == "*net/http.Request"
+		}
+		switch results := sig.Results(); {
+		case results.Len() == 1:
+			provider.Type = results.At(0).Type()
+		case results.Len() == 2 && types.Identical(results.At(1).Type(), types.Universe.Lookup("error").Type()):
+			provider.Type = results.At(0).Type()
+			provider.Err = true
+		default:
+			valid = false
+		}
+		if !valid {
+			p.AddErr(arg, CodeInvalidMapping, "provider %s must be func() T, func(context.Context) T or func(*http.Request) T, optionally returning (T, error), got %s", fn.Name(), sig)
+			continue
+		}
+		p.api.Providers = append(p.api.Providers, provider)
+	}
+}
+
 func (p *Parser) parseMappingWithCallExpr(expr ast.Expr, with *Mapping) (ok bool) {
 
 	callExpr, ok := expr.(*ast.CallExpr)
@@ -154,12 +246,22 @@ func (p *Parser) parseMappingWithCallExpr(expr ast.Expr, with *Mapping) (ok bool
 			with.HttpCode = p.parseMappingHttpCode(callExpr.Args)
 		case "PathPrefix":
 			with.PathPrefix = true
+		case "Ignore":
+			with.Ignore = true
 		case "HttpMethod":
 			with.HttpMethod = p.parseMappingHttpMethod(callExpr.Args)
 		case "BindQuery":
 			with.BindQuery = p.parseMappingBind(callExpr.Args)
 		case "BindHeader":
 			with.BindHeader = p.parseMappingBind(callExpr.Args)
+		case "BindCookie":
+			with.BindCookie = p.parseMappingBind(callExpr.Args)
+		case "BindForm":
+			with.BindForm = p.parseMappingBind(callExpr.Args)
+		case "PathParam":
+			if param, ok := p.parseMappingPathParam(callExpr, with.PathParams); ok {
+				with.PathParams = append(with.PathParams, param)
+			}
 		}
 		p.parseMappingWithCallExpr(t.X, with)
 	}
@@ -182,7 +284,7 @@ func (p *Parser) parseMappingHttpMethod(args []ast.Expr) string {
 	for _, arg := range p.mustArgsToString(args) {
 		return arg
 	}
-	p.AddErr(args[0], "unexpected HttpMethod arg: %v", args[0])
+	p.AddErr(args[0], CodeInvalidMapping, "unexpected HttpMethod arg: %v", args[0])
 	return ""
 }
 
@@ -204,6 +306,66 @@ func toType(obj types.Object) Type {
 	return t
 }
 
+// toCompositeType describes maps, arrays, nested slices and instantiated generics,
+// Name is a valid identifier used to name result variables
+func toCompositeType(t types.Type) Type {
+	return Type{
+		Name:        typeBaseName(t),
+		Kind:        compositeKind,
+		FullName:    types.TypeString(t, nil),
+		PackageName: types.TypeString(t, func(p *types.Package) string { return p.Name() }),
+	}
+}
+
+func typeBaseName(t types.Type) string {
+	switch t := types.Unalias(t).(type) {
+	case *types.Pointer:
+		return typeBaseName(t.Elem())
+	case *types.Slice:
+		return typeBaseName(t.Elem()) + "List"
+	case *types.Array:
+		return typeBaseName(t.Elem()) + "List"
+	case *types.Map:
+		return typeBaseName(t.Elem()) + "Map"
+	case *types.Named:
+		return t.Obj().Name()
+	case *types.Basic:
+		return t.Name()
+	}
+	return "value"
+}
+
+// typeImports returns the packages referenced by t, including type arguments
+func typeImports(t types.Type) []PackageItem {
+
+	var items []PackageItem
+	var walk func(t types.Type)
+	walk = func(t types.Type) {
+		switch t := types.Unalias(t).(type) {
+		case *types.Pointer:
+			walk(t.Elem())
+		case *types.Slice:
+			walk(t.Elem())
+		case *types.Array:
+			walk(t.Elem())
+		case *types.Map:
+			walk(t.Key())
+			walk(t.Elem())
+		case *types.Named:
+			if pkg := t.Obj().Pkg(); pkg != nil {
+				items = append(items, PackageItem{Name: pkg.Name(), Path: pkg.Path()})
+			}
+			for i := 0; i < t.TypeArgs().Len(); i++ {
+				walk(t.TypeArgs().At(i))
+			}
+		}
+	}
+	if t != nil {
+		walk(t)
+	}
+	return items
+}
+
 func (p *Parser) parseMappingBind(args []ast.Expr) []Type {
 	var bind []Type
 
@@ -219,18 +381,55 @@ func (p *Parser) parseMappingBind(args []ast.Expr) []Type {
 				continue
 			}
 			if i, ok := t.Type.(*ast.Ident); !ok {
-				p.AddErr(v, "unexpected Mapping Bind arg: %v, must format like foo.Foo{}", v)
+				p.AddErr(v, CodeInvalidMapping, "unexpected Mapping Bind arg: %v, must format like foo.Foo{}", v)
 			} else {
 				bind = append(bind, f(i))
 			}
 
 		default:
-			p.AddErr(v, "unexpected Mapping Bind arg: %v, must format like foo.Foo{}", v)
+			p.AddErr(v, CodeInvalidMapping, "unexpected Mapping Bind arg: %v, must format like foo.Foo{}", v)
 		}
 	}
 	return bind
 }
 
+func (p *Parser) parseMappingPathParam(callExpr *ast.CallExpr, declared []PathParam) (PathParam, bool) {
+
+	args := p.mustArgsToString(callExpr.Args)
+	if len(args) < 2 || len(args) != len(callExpr.Args) {
+		p.AddErr(callExpr, CodeInvalidMapping, "unexpected PathParam args: %v, expect a name followed by a handler arg or a constraint", args)
+		return PathParam{}, false
+	}
+	param := PathParam{Name: args[0], pos: p.fset.Position(callExpr.Fun.(*ast.SelectorExpr).Sel.Pos())}
+	if slices.ContainsFunc(declared, func(d PathParam) bool { return d.Name == param.Name }) {
+		p.AddErr(callExpr, CodeInvalidMapping, "multiple PathParam found for %s", param.Name)
+		return PathParam{}, false
+	}
+
+	for i, opt := range args[1:] {
+		expr := callExpr.Args[i+1]
+		if c, ok := pathConstraints[opt]; ok && param.Pattern == "" {
+			param.Format, param.Pattern = c.Format, c.Pattern
+			continue
+		}
+		switch {
+		case strings.HasPrefix(opt, "^") && param.Pattern == "":
+			if _, err := regexp.Compile(opt); err != nil {
+				p.AddErr(expr, CodeInvalidMapping, "invalid PathParam pattern of %s: %v", param.Name, err)
+				return PathParam{}, false
+			}
+			param.Pattern = opt
+		case token.IsIdentifier(opt) && param.Arg == "" && pathConstraints[opt].Pattern == "":
+			param.Arg = opt
+		default:
+			p.AddErr(expr, CodeInvalidMapping, "unexpected PathParam arg %q of %s, expect a handler arg, one of %s or a regular expression starting with ^, at most one of each",
+				opt, param.Name, strings.Join(sortedKeys(pathConstraints), ", "))
+			return PathParam{}, false
+		}
+	}
+	return param, true
+}
+
 func (p *Parser) parseMappingHttpCode(args []ast.Expr) int {
 
 	for _, arg := range p.mustArgsToString(args) {
@@ -240,7 +439,7 @@ func (p *Parser) parseMappingHttpCode(args []ast.Expr) int {
 		}
 		break
 	}
-	p.AddErr(args[0], "unexpected HttpStatus arg: %v", args[0])
+	p.AddErr(args[0], CodeInvalidMapping, "unexpected HttpStatus arg: %v", args[0])
 	return 0
 }
 
@@ -265,7 +464,7 @@ func (p *Parser) mustArgsToString(args []ast.Expr) []string {
 
 			c, ok := o.(*types.Const)
 			if !ok {
-				p.AddErr(arg, "args %v expect to be const string, but got: %v", arg, reflect.TypeOf(o))
+				p.AddErr(arg, CodeInvalidMapping, "args %v expect to be const string, but got: %v", arg, reflect.TypeOf(o))
 				continue
 			}
 			ss = append(ss, strings.Trim(c.Val().String(), "\""))
@@ -273,20 +472,153 @@ func (p *Parser) mustArgsToString(args []ast.Expr) []string {
 			o := p.objCache.ObjectOf(a.Sel)
 			c, ok := o.(*types.Const)
 			if !ok {
-				p.AddErr(arg, "args %v expect to be const string, but got: %v", arg, reflect.TypeOf(o))
+				p.AddErr(arg, CodeInvalidMapping, "args %v expect to be const string, but got: %v", arg, reflect.TypeOf(o))
 				continue
 			}
 
 			ss = append(ss, strings.Trim(c.Val().String(), "\""))
 		default:
-			p.AddErr(arg, "args %v expect to be const string, but got: %v ", arg, reflect.TypeOf(a))
+			p.AddErr(arg, CodeInvalidMapping, "args %v expect to be const string, but got: %v ", arg, reflect.TypeOf(a))
 		}
 	}
 	return ss
 }
 
-func (p *Parser) AddErr(expr ast.Expr, format string, a ...any) {
-	p.errs = append(p.errs, fmt.Errorf("%s: %s", p.fset.Position(expr.Pos()), fmt.Sprintf(format, a...)))
+func (p *Parser) AddErr(expr ast.Expr, code, format string, a ...any) {
+	p.diags = append(p.diags, p.errorAt(expr, code, format, a...))
+}
+
+func (p *Parser) errorAt(n ast.Node, code, format string, a ...any) Diagnostic {
+	return newDiagnostic(p.fset.Position(n.Pos()), SeverityError, code, format, a...)
+}
+
+// isHandlerCandidate reports whether decl may be a handler: exported top-level
+// functions and methods of services outside of _test.go files, except the
+// functions passed to nextgo.Provide
+func (p *Parser) isHandlerCandidate(decl *ast.FuncDecl) bool {
+	if !decl.Name.IsExported() {
+		return false
+	}
+	if fn, ok := p.objCache.ObjectOf(decl.Name).(*types.Func); ok && p.provided[fn.FullName()] {
+		return false
+	}
+	if decl.Recv != nil {
+		if _, ok := p.services[receiverTypeName(decl)]; !ok {
+			return false
+		}
+	}
+	return !strings.HasSuffix(p.fset.Position(decl.Pos()).Filename, "_test.go")
+}
+
+// receiverTypeName returns the name of the receiver type of a method, T for
+// both T and *T receivers
+func receiverTypeName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return ""
+	}
+	expr := decl.Recv.List[0].Type
+	if s, ok := expr.(*ast.StarExpr); ok {
+		expr = s.X
+	}
+	if i, ok := expr.(*ast.Ident); ok {
+		return i.Name
+	}
+	return ""
+}
+
+// parseProvidedFuncs returns the full names of the functions passed to
+// nextgo.Provide in file, invalid args are reported by parseProviders
+func (p *Parser) parseProvidedFuncs(file *ast.File) []string {
+	var funcs []string
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			for _, v := range vs.Values {
+				call, ok := p.nextgoCall(v, "Provide")
+				if !ok {
+					continue
+				}
+				for _, arg := range call.Args {
+					var ident *ast.Ident
+					switch t := arg.(type) {
+					case *ast.Ident:
+						ident = t
+					case *ast.SelectorExpr:
+						ident = t.Sel
+					}
+					if ident == nil {
+						continue
+					}
+					if fn, ok := p.objCache.ObjectOf(ident).(*types.Func); ok {
+						funcs = append(funcs, fn.FullName())
+					}
+				}
+			}
+		}
+	}
+	return funcs
+}
+
+// parseServices returns the types designated by nextgo.Service(T{}) in file,
+// they must be declared in the package of the file
+func (p *Parser) parseServices(file *ast.File) []Type {
+	var services []Type
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			for _, v := range vs.Values {
+				call, ok := p.nextgoCall(v, "Service")
+				if !ok {
+					continue
+				}
+				for _, t := range p.parseMappingBind(call.Args) {
+					if t.Path != p.packages.PkgPath {
+						p.AddErr(call, CodeInvalidMapping, "Service type %s must be declared in package %s", t.FullName, p.packages.PkgPath)
+						continue
+					}
+					services = append(services, t)
+				}
+			}
+		}
+	}
+	return services
+}
+
+func hasIgnoreDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == ignoreDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// dropMapping removes the annotation written for a function that is not generated,
+// so that it doesn't apply to the next handler
+func (p *Parser) dropMapping(m *Mapping) {
+	if m == nil || m.Ignore {
+		return
+	}
+	p.api.Annotations = slices.DeleteFunc(p.api.Annotations, func(a Mapping) bool {
+		return a.pos == m.pos
+	})
 }
 
 func (p *Parser) Visit(node ast.Node) ast.Visitor {
@@ -295,10 +627,38 @@ func (p *Parser) Visit(node ast.Node) ast.Visitor {
 	case *ast.TypeSpec:
 
 	case *ast.FuncDecl:
+		if !p.isHandlerCandidate(n) {
+			// the Mapping written above a skipped function must not apply to the next handler
+			if pending := p.pending; pending != nil {
+				p.pending = nil
+				if !pending.Ignore {
+					p.diags = append(p.diags, newDiagnostic(pending.pos, SeverityWarning, CodeInvalidMapping,
+						"Mapping is not applied, %s is not a handler: only exported functions and methods of services are", n.Name.Name))
+				}
+				p.dropMapping(pending)
+			}
+			return nil
+		}
+
+		pending := p.pending
+		p.pending = nil
+		if (pending != nil && pending.Ignore) || hasIgnoreDirective(n.Doc) {
+			p.dropMapping(pending)
+			return nil
+		}
+
 		handler, err := p.ParseHandler(n)
-		if err == nil {
-			p.api.Handlers = append(p.api.Handlers, *handler)
+		if err != nil {
+			var d Diagnostic
+			if !errors.As(err, &d) {
+				d = p.errorAt(n, CodeInvalidHandler, "%v", err)
+			}
+			p.diags = append(p.diags, d)
+			p.dropMapping(pending)
+			return nil
 		}
+		p.api.Handlers = append(p.api.Handlers, *handler)
+		return nil
 	case *ast.GenDecl:
 		if n.Tok == token.VAR {
 			_ = p.parseMappingWith(n)
@@ -321,6 +681,9 @@ func (p *Parser) parseSchema(node *ast.GenDecl) error {
 	if p.api.Schemas == nil {
 		p.api.Schemas = make(map[string]spec.Schema)
 	}
+	if p.api.Fields == nil {
+		p.api.Fields = make(map[string]map[string]SchemaField)
+	}
 
 	for _, sp := range node.Specs {
 		typeSpec, ok := sp.(*ast.TypeSpec)
@@ -334,9 +697,10 @@ func (p *Parser) parseSchema(node *ast.GenDecl) error {
 			continue
 		}
 
-		// We're only interested in struct types
+		// We're only interested in struct types, instantiated generic types are
+		// resolved through go/types when generating swagger
 		structType, ok := typeSpec.Type.(*ast.StructType)
-		if !ok {
+		if !ok || typeSpec.TypeParams != nil {
 			continue
 		}
 
@@ -347,6 +711,7 @@ func (p *Parser) parseSchema(node *ast.GenDecl) error {
 				Properties: make(map[string]spec.Schema),
 			},
 		}
+		fields := make(map[string]SchemaField)
 
 		for _, field := range structType.Fields.List {
 			fieldType := field.Type
@@ -372,8 +737,9 @@ func (p *Parser) parseSchema(node *ast.GenDecl) error {
 			// Parse field tags
 			var jsonName string
 			var required bool
+			var tags map[string]string
 			if field.Tag != nil {
-				tags := parseStructTags(field.Tag.Value)
+				tags = parseStructTags(unquote(field.Tag.Value))
 				if name, ok := tags["json"]; ok {
 					jsonName = name
 				}
@@ -431,6 +797,7 @@ func (p *Parser) parseSchema(node *ast.GenDecl) error {
 					jsonName = name
 				}
 				schema.Properties[jsonName] = fieldSchema
+				fields[jsonName] = SchemaField{Name: name, Tags: tags}
 				if required {
 					schema.Required = append(schema.Required, jsonName)
 				}
@@ -439,6 +806,7 @@ func (p *Parser) parseSchema(node *ast.GenDecl) error {
 
 		// Add schema to API schemas
 		p.api.Schemas[typeFullName] = schema
+		p.api.Fields[typeFullName] = fields
 	}
 
 	return nil
@@ -505,6 +873,13 @@ func parseStructTags(tag string) map[string]string {
 		tags["validate"] = v
 	}
 
+	// Names of the fields decoded by the codec
+	for _, key := range []string{"cookie", "form"} {
+		if v := st.Get(key); v != "" {
+			tags[key] = strings.Split(v, ",")[0]
+		}
+	}
+
 	if v := st.Get("example"); v != "" {
 		tags["example"] = v
 	}
@@ -550,9 +925,26 @@ func unwrapStarExpr(expr *ast.StarExpr) ast.Expr {
 
 func (p *Parser) ParseHandler(decl *ast.FuncDecl) (*HandleFunc, error) {
 
+	obj := p.objCache.ObjectOf(decl.Name)
+	if obj == nil || obj.Pkg() == nil {
+		// reported by the load diagnostics, e.g. a redeclared function
+		return nil, p.errorAt(decl.Name, CodeLoad, "can't resolve handler %s", decl.Name.Name)
+	}
+	pkg := obj.Pkg()
+
 	h := HandleFunc{
 		Name:        decl.Name.Name,
-		PackageName: p.objCache.ObjectOf(decl.Name).Pkg().Name(),
+		PackageName: pkg.Name(),
+	}
+
+	if decl.Recv != nil {
+		service := p.services[receiverTypeName(decl)]
+		_, service.Star = decl.Recv.List[0].Type.(*ast.StarExpr)
+		h.Service = &service
+		h.Receiver = "svc"
+		if names := decl.Recv.List[0].Names; len(names) > 0 && !isReservedName(names[0].Name, pkg.Name()) {
+			h.Receiver = names[0].Name
+		}
 	}
 
 	if decl.Doc != nil {
@@ -563,24 +955,85 @@ func (p *Parser) ParseHandler(decl *ast.FuncDecl) (*HandleFunc, error) {
 		h.Doc = strings.TrimSpace(strings.Join(docs, "\n"))
 	}
 
-	obj := p.objCache.ObjectOf(decl.Name)
-	pkg := obj.Pkg()
-
 	h.RouteInfoPackage = PackageItem{
 		Name: pkg.Name(),
 		Path: pkg.Path(),
 	}
+	h.HandlerPackage = h.RouteInfoPackage
 
-	h.RequestArgs = p.parseHandlerArg(decl.Type.Params)
-	h.ResponseResult = p.parseHandlerArg(decl.Type.Results)
+	if err := p.checkHandlerSignature(decl); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if h.RequestArgs, err = p.parseHandlerArg(decl.Type.Params); err != nil {
+		return nil, err
+	}
+	if h.ResponseResult, err = p.parseHandlerArg(decl.Type.Results); err != nil {
+		return nil, err
+	}
 	h.Pos = p.fset.Position(decl.Pos())
 	return &h, nil
 }
 
-func (p *Parser) parseHandlerArg(list *ast.FieldList) []Arg {
+// checkHandlerSignature rejects the functions the generated code can't call,
+// handlers return error, (T, error) or (int, T, error) and take named, non
+// variadic args
+func (p *Parser) checkHandlerSignature(decl *ast.FuncDecl) error {
+
+	invalid := func(n ast.Node, format string, a ...any) error {
+		return p.errorAt(n, CodeInvalidHandler, "%s is not a valid handler: %s, add %s to skip it",
+			decl.Name.Name, fmt.Sprintf(format, a...), ignoreDirective)
+	}
+
+	if decl.Type.TypeParams != nil {
+		return invalid(decl.Type.TypeParams, "type parameters are not supported")
+	}
+
+	var results []ast.Expr
+	if decl.Type.Results != nil {
+		for _, field := range decl.Type.Results.List {
+			for range max(len(field.Names), 1) {
+				results = append(results, field.Type)
+			}
+		}
+	}
+	if len(results) == 0 {
+		return invalid(decl.Name, "expect error, (T, error) or (int, T, error) results")
+	}
+	last := results[len(results)-1]
+	if t := p.packages.TypesInfo.TypeOf(last); t == nil || !types.Identical(t, types.Universe.Lookup("error").Type()) {
+		return invalid(last, "the last result must be error")
+	}
+	if len(results) > 3 {
+		return invalid(results[1], "more than one body result")
+	}
+	if len(results) == 3 {
+		if t := p.packages.TypesInfo.TypeOf(results[0]); t == nil || !types.Identical(t, types.Typ[types.Int]) {
+			return invalid(results[1], "more than one body result, the first of three results is the int status code")
+		}
+	}
+
+	for _, field := range decl.Type.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			return invalid(field, "variadic args are not supported")
+		}
+		if len(field.Names) == 0 {
+			return invalid(field, "args must be named")
+		}
+		for _, name := range field.Names {
+			if name.Name == "_" {
+				return invalid(name, "args must be named")
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Parser) parseHandlerArg(list *ast.FieldList) ([]Arg, error) {
 
 	if list == nil {
-		return []Arg{}
+		return []Arg{}, nil
 	}
 
 	var args []Arg
@@ -595,14 +1048,30 @@ func (p *Parser) parseHandlerArg(list *ast.FieldList) []Arg {
 			a.Star = true
 			expr = unwrapStarExpr(s)
 		}
+		if arr, ok := expr.(*ast.ArrayType); ok && arr.Len == nil {
+			a.Slice = true
+			expr = arr.Elt
+			if s, ok := expr.(*ast.StarExpr); ok {
+				a.Star = true
+				expr = unwrapStarExpr(s)
+			}
+		}
+
+		a.GoType = p.packages.TypesInfo.TypeOf(l.Type)
+		a.elemType = p.packages.TypesInfo.TypeOf(expr)
+		a.Imports = typeImports(a.elemType)
 
 		switch t := expr.(type) {
 		case *ast.Ident:
 			a.ObjectTypes = p.objCache.ObjectOf(t)
 		case *ast.SelectorExpr:
 			a.ObjectTypes = p.objCache.ObjectOf(t.Sel)
+		case *ast.ArrayType, *ast.MapType, *ast.IndexExpr, *ast.IndexListExpr:
+			if a.elemType != nil {
+				a.Type = toCompositeType(a.elemType)
+			}
 		default:
-			p.AddErr(expr, "unexpected type: %v", reflect.TypeOf(t))
+			return nil, p.errorAt(expr, CodeInvalidHandler, "unexpected type: %v", reflect.TypeOf(t))
 		}
 
 		if a.ObjectTypes != nil {
@@ -626,7 +1095,7 @@ func (p *Parser) parseHandlerArg(list *ast.FieldList) []Arg {
 			args = append(args, a)
 		}
 	}
-	return args
+	return args, nil
 }
 
 func Beautify(o any) string {
@@ -636,36 +1105,50 @@ func Beautify(o any) string {
 
 func load(root string, tag ...string) ([]*packages.Package, error) {
 
+	// only directories with go files, the others fail to load with "no Go files"
 	var dirs []string
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() {
-			dirs = append(dirs, path)
+		if dir := filepath.Dir(path); !info.IsDir() && filepath.Ext(path) == ".go" && !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
+	var flags []string
+	if len(tag) > 0 {
+		flags = append(flags, "-tags="+strings.Join(tag, ","))
+	}
 	return packages.Load(&packages.Config{
 		Mode:       packages.LoadAllSyntax,
 		Dir:        root,
-		BuildFlags: tag,
+		BuildFlags: flags,
 	}, dirs...)
 }
 
-func Parse(root string, tag ...string) (*RestfulApi, error) {
-	pkgs, err := load(root)
+// Parse parses the api tree under root with the build tags and returns the
+// diagnostics found along the routes. The error is set when the routes can't be
+// built, positioned errors are Diagnostic values and part of the returned
+// diagnostics as well.
+func Parse(root string, tag ...string) (*RestfulApi, Diagnostics, error) {
+	pkgs, err := load(root, tag...)
 	if err != nil {
-		log.Fatalf("load pkgs failed: %v", err)
+		return nil, nil, fmt.Errorf("load pkgs failed: %w", err)
 	}
 
+	diags := loadDiagnostics(pkgs)
 	objCache := NewObjectCache(pkgs)
 
 	api := API{}
-	for _, p := range pkgs {
+	// providers may be declared in any package of the tree, they are never handlers
+	provided := map[string]bool{}
+	pkgServices := make([]map[string]Type, len(pkgs))
+	for i, p := range pkgs {
+		pkgServices[i] = map[string]Type{}
 		for _, f := range p.Syntax {
 			v := &Parser{
 				packages: p,
@@ -673,14 +1156,39 @@ func Parse(root string, tag ...string) (*RestfulApi, error) {
 				objCache: objCache,
 				api:      &api,
 			}
-			ast.Walk(v, f)
-			for _, err := range v.errs {
-				fmt.Println("ast walk failed", err)
+			for _, t := range v.parseServices(f) {
+				pkgServices[i][t.Name] = t
+			}
+			for _, fn := range v.parseProvidedFuncs(f) {
+				provided[fn] = true
 			}
+			diags = append(diags, v.diags...)
+		}
+	}
+
+	for i, p := range pkgs {
+		for _, f := range p.Syntax {
+			v := &Parser{
+				packages: p,
+				fset:     p.Fset,
+				objCache: objCache,
+				api:      &api,
+				services: pkgServices[i],
+				provided: provided,
+			}
+			ast.Walk(v, f)
+			diags = append(diags, v.diags...)
 		}
 	}
 
 	restapi, err := BuildRestfulApi(root, api)
+	if err != nil {
+		var d Diagnostic
+		if errors.As(err, &d) {
+			diags = append(diags, d)
+		}
+		return nil, sortDiagnostics(diags), err
+	}
 
-	return restapi, err
+	return restapi, sortDiagnostics(append(diags, restapi.Diagnostics...)), nil
 }
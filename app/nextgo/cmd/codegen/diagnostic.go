@@ -0,0 +1,165 @@
+package codegen
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic codes
+const (
+	// CodeLoad reports packages of the api tree that fail to load or type check
+	CodeLoad = "load"
+	// CodeInvalidMapping reports Mapping and MappingFile declarations that can't be parsed
+	CodeInvalidMapping = "invalid-mapping"
+	// CodeInvalidHandler reports exported functions skipped for an unsupported signature
+	CodeInvalidHandler = "invalid-handler"
+	// CodeDuplicateRoute reports handlers serving the same method and path
+	CodeDuplicateRoute = "duplicate-route"
+	// CodeAmbiguousRoute reports routes matching the same requests
+	CodeAmbiguousRoute = "ambiguous-route"
+)
+
+// DiagnosticsFormat values accepted by Diagnostics.Write
+const (
+	DiagnosticsText = "text"
+	DiagnosticsJSON = "json"
+)
+
+// Diagnostic is a problem found in the api tree, reported at file:line:col
+type Diagnostic struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Message  string   `json:"message"`
+}
+
+func newDiagnostic(pos token.Position, severity Severity, code, format string, a ...any) Diagnostic {
+	return Diagnostic{
+		File:     pos.Filename,
+		Line:     pos.Line,
+		Column:   pos.Column,
+		Severity: severity,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+	}
+}
+
+// Pos returns the position of the diagnostic
+func (d Diagnostic) Pos() token.Position {
+	return token.Position{Filename: d.File, Line: d.Line, Column: d.Column}
+}
+
+func (d Diagnostic) Error() string {
+	if pos := d.Pos(); pos.IsValid() {
+		return fmt.Sprintf("%s: %s", pos, d.Message)
+	}
+	return d.Message
+}
+
+type Diagnostics []Diagnostic
+
+// HasErrors reports whether any diagnostic has error severity
+func (ds Diagnostics) HasErrors() bool {
+	for _, d := range ds {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Write writes the diagnostics to w in text, one "file:line:col: severity: message [code]"
+// per line, or as a JSON array
+func (ds Diagnostics) Write(w io.Writer, format string) error {
+	switch format {
+	case DiagnosticsText, "":
+		for _, d := range ds {
+			line := fmt.Sprintf("%s: %s [%s]", d.Severity, d.Message, d.Code)
+			if pos := d.Pos(); pos.IsValid() {
+				line = pos.String() + ": " + line
+			} else if d.File != "" {
+				line = d.File + ": " + line
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	case DiagnosticsJSON:
+		if ds == nil {
+			ds = Diagnostics{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ds)
+	}
+	return fmt.Errorf("unknown diagnostics format %q, expect %s or %s", format, DiagnosticsText, DiagnosticsJSON)
+}
+
+// sortDiagnostics sorts ds by position, keeping the order of diagnostics at the same position
+func sortDiagnostics(ds Diagnostics) Diagnostics {
+	slices.SortStableFunc(ds, func(a, b Diagnostic) int {
+		if c := strings.Compare(a.File, b.File); c != 0 {
+			return c
+		}
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return a.Column - b.Column
+	})
+	return ds
+}
+
+// loadDiagnostics converts the errors of pkgs and their dependencies
+func loadDiagnostics(pkgs []*packages.Package) Diagnostics {
+	var ds Diagnostics
+	seen := map[string]bool{}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, e := range pkg.Errors {
+			if strings.Contains(e.Msg, "build constraints exclude all Go files") {
+				// directories only built with other tags
+				continue
+			}
+			d := newDiagnostic(parsePosition(e.Pos), SeverityError, CodeLoad, "%s", strings.TrimSpace(e.Msg))
+			if key := d.Error(); !seen[key] {
+				seen[key] = true
+				ds = append(ds, d)
+			}
+		}
+	})
+	return ds
+}
+
+// parsePosition parses the "file:line:col" or "file:line" position of packages.Error
+func parsePosition(s string) token.Position {
+	var pos token.Position
+	parts := strings.Split(s, ":")
+	for i := 0; i < 2 && len(parts) > 1; i++ {
+		n, err := strconv.Atoi(parts[len(parts)-1])
+		if err != nil {
+			break
+		}
+		pos.Column, pos.Line = pos.Line, n
+		parts = parts[:len(parts)-1]
+	}
+	if s != "-" {
+		pos.Filename = strings.Join(parts, ":")
+	}
+	return pos
+}
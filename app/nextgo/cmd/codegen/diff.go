@@ -0,0 +1,178 @@
+package codegen
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines around a change in a hunk
+const diffContext = 3
+
+// maxDiffTable bounds the cells of the longest common subsequence table, larger
+// changes are diffed as a removal of the old lines followed by the new ones
+const maxDiffTable = 1 << 22
+
+type diffOp struct {
+	kind byte   // ' ', '-' or '+'
+	line string // the line with its newline, if any
+}
+
+// unifiedDiff returns the unified diff turning a into b, empty if they are
+// equal. A nil a is a new file and a nil b a deleted one.
+func unifiedDiff(name string, a, b []byte) string {
+
+	if string(a) == string(b) {
+		return ""
+	}
+	ops := diffLines(splitLines(string(a)), splitLines(string(b)))
+
+	aName, bName := "a/"+name, "b/"+name
+	if a == nil {
+		aName = "/dev/null"
+	}
+	if b == nil {
+		bName = "/dev/null"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// expand the hunk while changes are closer than 2*diffContext lines
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext, len(ops))
+
+		aStart, bStart := 1, 1
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				aStart++
+			}
+			if op.kind != '-' {
+				bStart++
+			}
+		}
+		aLen, bLen := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		start--
+	}
+	if length == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+// splitLines splits s after each newline, the last line lacks it if s does
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines computes the line edit script of a and b by longest common
+// subsequence of the lines between their common prefix and suffix
+func diffLines(a, b []string) []diffOp {
+
+	var ops []diffOp
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		ops = append(ops, diffOp{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	var suffix []string
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append(suffix, a[len(a)-1])
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+
+	if (len(a)+1)*(len(b)+1) <= maxDiffTable {
+		ops = append(ops, lcsLines(a, b)...)
+	} else {
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+	}
+
+	for i := len(suffix) - 1; i >= 0; i-- {
+		ops = append(ops, diffOp{' ', suffix[i]})
+	}
+	return ops
+}
+
+func lcsLines(a, b []string) []diffOp {
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
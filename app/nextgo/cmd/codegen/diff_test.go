@@ -0,0 +1,116 @@
+package codegen
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// numbered returns the lines 1..n, replaced by the values of edits
+func numbered(n int, edits map[int]string) []byte {
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		line, ok := edits[i]
+		if !ok {
+			line = strconv.Itoa(i)
+		}
+		sb.WriteString(line + "\n")
+	}
+	return []byte(sb.String())
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []byte
+		want string
+	}{
+		{
+			name: "equal",
+			a:    []byte("a\nb\n"),
+			b:    []byte("a\nb\n"),
+			want: "",
+		},
+		{
+			name: "changed line",
+			a:    []byte("x\n"),
+			b:    []byte("y\n"),
+			want: "--- a/f.go\n+++ b/f.go\n@@ -1 +1 @@\n-x\n+y\n",
+		},
+		{
+			name: "context",
+			a:    numbered(10, nil),
+			b:    numbered(10, map[int]string{5: "five"}),
+			want: "--- a/f.go\n+++ b/f.go\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "merged hunk",
+			a:    numbered(20, nil),
+			b:    numbered(20, map[int]string{5: "five", 12: "twelve"}),
+			want: "--- a/f.go\n+++ b/f.go\n@@ -2,14 +2,14 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n 9\n 10\n 11\n-12\n+twelve\n 13\n 14\n 15\n",
+		},
+		{
+			name: "separate hunks",
+			a:    numbered(20, nil),
+			b:    numbered(20, map[int]string{5: "five", 13: "thirteen"}),
+			want: "--- a/f.go\n+++ b/f.go\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n" +
+				"@@ -10,7 +10,7 @@\n 10\n 11\n 12\n-13\n+thirteen\n 14\n 15\n 16\n",
+		},
+		{
+			name: "inserted lines",
+			a:    []byte("a\nd\n"),
+			b:    []byte("a\nb\nc\nd\n"),
+			want: "--- a/f.go\n+++ b/f.go\n@@ -1,2 +1,4 @@\n a\n+b\n+c\n d\n",
+		},
+		{
+			name: "new file",
+			a:    nil,
+			b:    []byte("a\nb\n"),
+			want: "--- /dev/null\n+++ b/f.go\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name: "deleted file",
+			a:    []byte("a\nb\n"),
+			b:    nil,
+			want: "--- a/f.go\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name: "trailing newline removed",
+			a:    []byte("a\nb\n"),
+			b:    []byte("a\nb"),
+			want: "--- a/f.go\n+++ b/f.go\n@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			name: "trailing newline added",
+			a:    []byte("a"),
+			b:    []byte("a\n"),
+			want: "--- a/f.go\n+++ b/f.go\n@@ -1 +1 @@\n-a\n\\ No newline at end of file\n+a\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("f.go", tt.a, tt.b); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	// the changed lines exceed maxDiffTable, they are diffed as removed and added
+	a := strings.Repeat("a\n", 3000)
+	b := "head\n" + strings.Repeat("b\n", 3000) + "tail\n"
+	ops := diffLines(splitLines("head\n"+a+"tail\n"), splitLines(b))
+	var removed, added int
+	for _, op := range ops {
+		switch op.kind {
+		case '-':
+			removed++
+		case '+':
+			added++
+		}
+	}
+	if len(ops) != 6002 || removed != 3000 || added != 3000 || ops[0].line != "head\n" || ops[len(ops)-1].line != "tail\n" {
+		t.Errorf("unexpected ops: %d ops, %d removed, %d added", len(ops), removed, added)
+	}
+}
@@ -3,14 +3,21 @@ package codegen
 import (
 	"bytes"
 	_ "embed"
+	"errors"
 	"fmt"
+	"go/types"
+	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"text/template"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/justinas/alice"
 	"github.com/samber/lo"
@@ -41,6 +48,21 @@ type option struct {
 	handleTmpl      *template.Template
 	importTmpl      *template.Template
 	serverTmpl      *template.Template
+
+	// written holds the files written by this run
+	written map[string]bool
+
+	// check renders into memory and diffs against the files on disk instead of writing
+	check   bool
+	diffOut io.Writer
+	// outdated holds the files differing from the rendered output in check mode
+	outdated []string
+
+	// buildTags the api dir was parsed with, generated files are constrained to them
+	buildTags []string
+
+	// logOut receives the progress messages, e.g. the removed stale files
+	logOut io.Writer
 }
 
 func newDefaultOption() *option {
@@ -67,24 +89,106 @@ func newDefaultOption() *option {
 
 type GenerateOptionFunc func(opt *option)
 
+// WithCheck renders the generated files in memory and writes a unified diff
+// against the files on disk to w, nothing is written. Generate and GenerateSwag
+// then fail if any file is out of date.
+func WithCheck(w io.Writer) GenerateOptionFunc {
+	return func(opt *option) {
+		opt.check = true
+		opt.diffOut = w
+	}
+}
+
+// WithLog writes progress messages such as the removed stale generated files to w
+func WithLog(w io.Writer) GenerateOptionFunc {
+	return func(opt *option) {
+		opt.logOut = w
+	}
+}
+
+// WithBuildTags adds a //go:build line requiring all tags to the generated files,
+// the routes parsed with these tags only build with them
+func WithBuildTags(tags ...string) GenerateOptionFunc {
+	return func(opt *option) {
+		opt.buildTags = tags
+	}
+}
+
 // Generate generates the code for the given APIs.
-func Generate(srcDir, outputDir, outPkgPrefix string, apis *RestfulApi) error {
+// Routes are generated sorted by path, method and name so the output is byte-stable,
+// generated files left over from deleted handlers are removed from outputDir.
+func Generate(srcDir, outputDir, outPkgPrefix string, apis *RestfulApi, opts ...GenerateOptionFunc) error {
 
 	o := newDefaultOption()
 	o.outputDir = outputDir
 	o.srcDir = srcDir
 	o.outputPkgPrefix = outPkgPrefix
+	for _, f := range opts {
+		f(o)
+	}
+
+	handlers := sortedHandlers(apis.Apis)
+	for i, h := range handlers {
+		h.mergeMapping()
+		h.GeneratedPackageInfo = PackageItem{
+			Name: h.RouteInfoPackage.Name,
+			Path: o.getGeneratedPkgPath(h.Pos.Filename),
+		}
+		handlers[i] = h
+	}
 
-	for _, handlers := range apis.Apis {
-		if err := o.generateApiHandler(handlers); err != nil {
+	for _, fileHandlers := range groupHandlersByFile(handlers) {
+		if err := o.generateApiHandler(fileHandlers); err != nil {
 			return err
 		}
 	}
 
-	if err := o.generateServer(filepath.Dir(outputDir), outPkgPrefix, apis.Apis); err != nil {
+	if err := o.generateServer(filepath.Dir(outputDir), outPkgPrefix, handlers); err != nil {
 		return err
 	}
-	return nil
+	if err := o.pruneGenerated(); err != nil {
+		return err
+	}
+	return o.checkResult()
+}
+
+// sortedHandlers flattens apis sorted by path, method and handler name
+func sortedHandlers(apis map[string]map[string]HandleFunc) []HandleFunc {
+
+	var handlers []HandleFunc
+	for _, methods := range apis {
+		for _, h := range methods {
+			handlers = append(handlers, h)
+		}
+	}
+	slices.SortFunc(handlers, func(a, b HandleFunc) int {
+		if c := strings.Compare(a.Patten, b.Patten); c != 0 {
+			return c
+		}
+		if c := strings.Compare(routeMethod(a), routeMethod(b)); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return handlers
+}
+
+// groupHandlersByFile groups handlers by source file, sorted by file name
+func groupHandlersByFile(handlers []HandleFunc) [][]HandleFunc {
+
+	files := map[string][]HandleFunc{}
+	for _, h := range handlers {
+		files[h.Pos.Filename] = append(files[h.Pos.Filename], h)
+	}
+
+	filenames := lo.Keys(files)
+	slices.Sort(filenames)
+
+	var groups [][]HandleFunc
+	for _, f := range filenames {
+		groups = append(groups, files[f])
+	}
+	return groups
 }
 
 type serverApiData struct {
@@ -94,10 +198,19 @@ type serverApiData struct {
 	HandleFunc        string
 	HandleFuncPackage string
 	Middlewares       []string
+	// Service is the application field holding the service of method handlers
+	Service string
+}
+
+type serverServiceData struct {
+	Name     string
+	Field    string
+	TypeExpr string
 }
 
 type serverData struct {
 	Middlewares []string
+	Services    []serverServiceData
 	Apis        []serverApiData
 	Imports     []PackageItem
 	PackageName string
@@ -107,19 +220,20 @@ type serverData struct {
 	GoHttpPackage     PackageItem
 }
 
-func (o *option) generateServer(outputDir string, packagePrefix string, apis map[string]map[string]HandleFunc) error {
+func (o *option) generateServer(outputDir string, packagePrefix string, handlers []HandleFunc) error {
 
 	svrData := serverData{
 		PackageName: filepath.Base(o.outputDir),
 	}
 
 	var imports []PackageItem
-	for _, p := range apis {
-		for _, h := range p {
-			imports = append(imports, h.GeneratedPackageInfo)
-			break
+	for _, h := range handlers {
+		imports = append(imports, h.GeneratedPackageInfo)
+		if h.Service != nil {
+			imports = append(imports, h.Service.PackageItem)
 		}
 	}
+	slices.SortFunc(imports, func(a, b PackageItem) int { return strings.Compare(a.Path, b.Path) })
 	imports = append(imports, getPackageItem[http2.Server]())
 	imports = aliasImports(lo.UniqBy(append(imports, defaultPkgs...), func(item PackageItem) string { return item.Path }))
 
@@ -128,33 +242,43 @@ func (o *option) generateServer(outputDir string, packagePrefix string, apis map
 	svrData.AliceChainPackage = aliasImportsPackage(imports, aliceChainPackage)
 
 	var apiData []serverApiData
-	for patten, p := range apis {
-		for m, h := range p {
-			h.mergeMapping()
-			d := serverApiData{
-				Match: func(isPrefix bool) string {
-					if isPrefix {
-						return "PathPrefix"
-					}
-					return "Path"
-				}(h.With.PathPrefix),
-				Patten:     patten,
-				Method:     m,
-				HandleFunc: h.Name,
-				HandleFuncPackage: func(h HandleFunc) string {
-					p, _ := lo.Find(imports, func(item PackageItem) bool {
-						return item.Path == h.GeneratedPackageInfo.Path
-					})
-					if p.Alias != "" {
-						return p.Alias
-					}
-					return p.Name
-				}(h),
-				Middlewares: h.Middlewares,
+	for _, h := range handlers {
+		d := serverApiData{
+			Match: func(isPrefix bool) string {
+				if isPrefix {
+					return "PathPrefix"
+				}
+				return "Path"
+			}(h.With.PathPrefix),
+			Patten:     h.Patten,
+			Method:     routeMethod(h),
+			HandleFunc: h.GeneratedName(),
+			HandleFuncPackage: func(h HandleFunc) string {
+				p, _ := lo.Find(imports, func(item PackageItem) bool {
+					return item.Path == h.GeneratedPackageInfo.Path
+				})
+				if p.Alias != "" {
+					return p.Alias
+				}
+				return p.Name
+			}(h),
+			Middlewares: h.Middlewares,
+		}
+		if h.Service != nil {
+			svc := serverServiceData{
+				Name:     h.Service.Name,
+				Field:    strings.ToLower(h.Service.Name[:1]) + h.Service.Name[1:],
+				TypeExpr: aliasImportsPackage(imports, h.Service.PackageItem).Alias + "." + h.Service.Name,
+			}
+			if prev, ok := lo.Find(svrData.Services, func(s serverServiceData) bool { return s.Name == svc.Name }); !ok {
+				svrData.Services = append(svrData.Services, svc)
+			} else if prev.TypeExpr != svc.TypeExpr {
+				return fmt.Errorf("services %s and %s have the same name, the option With%s would serve both", prev.TypeExpr, svc.TypeExpr, svc.Name)
 			}
-			svrData.Middlewares = lo.Uniq(append(svrData.Middlewares, d.Middlewares...))
-			apiData = append(apiData, d)
+			d.Service = svc.Field
 		}
+		svrData.Middlewares = lo.Uniq(append(svrData.Middlewares, d.Middlewares...))
+		apiData = append(apiData, d)
 	}
 
 	svrData.Imports = imports
@@ -165,16 +289,29 @@ func (o *option) generateServer(outputDir string, packagePrefix string, apis map
 	if err := o.serverTmpl.Execute(&buf, svrData); err != nil {
 		return err
 	}
-	return writeFile(filepath.Join(outputDir, "server.go"), buf.Bytes())
+	return o.writeFile(filepath.Join(outputDir, "server.go"), buf.Bytes())
 }
 
-func (o *option) getGeneratedPkgPath(relativeFilename string) string {
+func (o *option) getGeneratedPkgPath(filename string) string {
 
-	pkg := filepath.Dir(strings.TrimPrefix(relativeFilename, o.srcDir))
+	pkg := filepath.Dir(o.generatedFile(filename))
 	return filepath.Join(o.outputPkgPrefix, pkg)
 }
 
-func (o *option) generateApiHandler(handlers map[string]HandleFunc) error {
+// generatedFile returns the file generated for the handler file filename,
+// relative to outputDir
+func (o *option) generatedFile(filename string) string {
+
+	f := strings.TrimPrefix(filename, o.srcDir)
+	dirs := strings.Split(filepath.Dir(f), string(filepath.Separator))
+	for i, dir := range dirs {
+		dirs[i] = generatedDirName(dir)
+	}
+	return filepath.Join(filepath.Join(dirs...), filepath.Base(f))
+}
+
+// generateApiHandler generates the handlers of the same source file into one file
+func (o *option) generateApiHandler(handlers []HandleFunc) error {
 
 	var buf bytes.Buffer
 
@@ -187,30 +324,16 @@ func (o *option) generateApiHandler(handlers map[string]HandleFunc) error {
 	buf.WriteString(bs.String())
 	buf.WriteString("\n")
 
-	for k, v := range handlers {
+	for _, v := range handlers {
 		s, err := o.generateHandler(v, apiImports)
 		if err != nil {
 			return err
 		}
 		buf.WriteString(s)
 		buf.WriteString("\n")
-
-		v.GeneratedPackageInfo = PackageItem{
-			Name: v.RouteInfoPackage.Name,
-			Path: o.getGeneratedPkgPath(strings.TrimPrefix(v.Pos.Filename, o.srcDir)),
-		}
-		handlers[k] = v
-
 	}
 
-	for _, v := range handlers {
-		f := strings.TrimPrefix(v.Pos.Filename, o.srcDir)
-		if err := writeFile(filepath.Join(o.outputDir, f), buf.Bytes()); err != nil {
-			return err
-		}
-		return nil
-	}
-	return nil
+	return o.writeFile(filepath.Join(o.outputDir, o.generatedFile(handlers[0].Pos.Filename)), buf.Bytes())
 }
 
 type PackageItem struct {
@@ -224,7 +347,7 @@ type packageImports struct {
 	Imports     []PackageItem
 }
 
-func (o *option) generateApiImports(handlers map[string]HandleFunc) *packageImports {
+func (o *option) generateApiImports(handlers []HandleFunc) *packageImports {
 
 	p := packageImports{}
 
@@ -236,14 +359,22 @@ func (o *option) generateApiImports(handlers map[string]HandleFunc) *packageImpo
 		}
 
 		p.PackageName = v.PackageName
-		for _, a := range append(v.RequestArgs, v.ResponseResult...) {
-			if a.Package.Path == "" {
-				continue
+		// results are assigned with :=, only the body types are referenced by the route info
+		for _, a := range append(v.ResponseBody(), v.RequestArgs...) {
+			items := append([]PackageItem{a.Package}, a.Imports...)
+			if a.Provider != nil {
+				// provided args only reference the provider package
+				items = []PackageItem{a.Provider.Package}
+			}
+			for _, item := range items {
+				if item.Path == "" {
+					continue
+				}
+				p.Imports = append(p.Imports, PackageItem{
+					Name: item.Name,
+					Path: item.Path,
+				})
 			}
-			p.Imports = append(p.Imports, PackageItem{
-				Name: a.Package.Name,
-				Path: a.Package.Path,
-			})
 		}
 	}
 
@@ -255,26 +386,71 @@ func (o *option) generateApiImports(handlers map[string]HandleFunc) *packageImpo
 	return &p
 }
 
+// aliasImports aliases the imports sharing a package name by the shortest
+// trailing elements of their import paths telling them apart, e.g. nethttp and
+// nextgohttp, so adding or removing a route doesn't rename the other imports.
 func aliasImports(imports []PackageItem) []PackageItem {
-	nameCount := make(map[string]int)
-	for _, imp := range imports {
-		nameCount[imp.Name]++
+	byName := make(map[string][]int)
+	for i, imp := range imports {
+		byName[imp.Name] = append(byName[imp.Name], i)
 	}
 
-	for i, imp := range imports {
-		if nameCount[imp.Name] > 1 {
-			imports[i].Alias = imp.Name + strconv.Itoa(i)
+	used := make(map[string]bool)
+	for name, idx := range byName {
+		if len(idx) == 1 {
+			used[name] = true
+		}
+	}
+
+	for _, name := range sortedKeys(byName) {
+		idx := byName[name]
+		if len(idx) == 1 {
+			continue
+		}
+		for _, i := range idx {
+			alias := ""
+			for n := 2; ; n++ {
+				alias = pathAlias(imports[i].Path, n)
+				unique := !used[alias]
+				for _, j := range idx {
+					if j != i && pathAlias(imports[j].Path, n) == alias {
+						unique = false
+					}
+				}
+				if unique || n > strings.Count(imports[i].Path, "/") {
+					break
+				}
+			}
+			for k, base := 2, alias; used[alias]; k++ {
+				alias = base + strconv.Itoa(k)
+			}
+			used[alias] = true
+			imports[i].Alias = alias
 		}
 	}
 	return imports
 }
 
-func writeFile(f string, data []byte) error {
-
-	dir, _ := filepath.Split(f)
-	if err := os.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
-		return nil
+// pathAlias joins the last n elements of an import path into an identifier,
+// e.g. nethttp for net/http
+func pathAlias(path string, n int) string {
+	elems := strings.Split(path, "/")
+	elems = elems[max(len(elems)-n, 0):]
+	alias := strings.Map(func(r rune) rune {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, strings.Join(elems, ""))
+	if alias == "" || unicode.IsDigit(rune(alias[0])) {
+		alias = "p" + alias
 	}
+	return alias
+}
+
+const generatedHeader = "// Code generated by nextgo; DO NOT EDIT."
+
+func (o *option) writeFile(f string, data []byte) error {
 
 	out, err := imports.Process(".", data, &imports.Options{
 		FormatOnly: true,
@@ -282,11 +458,137 @@ func writeFile(f string, data []byte) error {
 	if err != nil {
 		return fmt.Errorf("imports process err:%w, code:%s", err, string(data))
 	}
-	data = []byte("// Code generated by nextgo; DO NOT EDIT.\n\n" + string(out))
+	if !bytes.HasPrefix(out, []byte(generatedHeader)) {
+		out = []byte(generatedHeader + "\n\n" + string(out))
+	}
+	if len(o.buildTags) > 0 {
+		out = []byte("//go:build " + strings.Join(o.buildTags, " && ") + "\n\n" + string(out))
+	}
+
+	return o.output(f, out)
+}
+
+// output writes data to f, or diffs it against f in check mode
+func (o *option) output(f string, data []byte) error {
+
+	if o.written == nil {
+		o.written = map[string]bool{}
+	}
+	o.written[f] = true
 
+	if o.check {
+		old, err := os.ReadFile(f)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		o.diff(f, old, data)
+		return nil
+	}
+
+	dir, _ := filepath.Split(f)
+	if err := os.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
 	return os.WriteFile(f, data, 0664)
 }
 
+func (o *option) diff(f string, old, data []byte) {
+
+	d := unifiedDiff(o.relativePath(f), old, data)
+	if d == "" {
+		return
+	}
+	o.outdated = append(o.outdated, f)
+	if o.diffOut != nil {
+		_, _ = io.WriteString(o.diffOut, d)
+	}
+}
+
+func (o *option) relativePath(f string) string {
+	if rel, err := filepath.Rel(filepath.Dir(o.outputDir), f); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return f
+}
+
+// checkResult fails if any file is out of date in check mode
+func (o *option) checkResult() error {
+	if len(o.outdated) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d generated files are out of date, run the generate command without --check", len(o.outdated))
+}
+
+// pruneGenerated removes the files under outputDir generated by nextgo but not
+// written by this run, files without the generated header are never touched.
+func (o *option) pruneGenerated() error {
+
+	var stale []string
+	err := filepath.WalkDir(o.outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if o.check && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || filepath.Ext(path) != ".go" || o.written[path] {
+			return nil
+		}
+		generated, err := isGeneratedFile(path)
+		if err != nil {
+			return err
+		}
+		if generated {
+			stale = append(stale, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, f := range stale {
+		if o.check {
+			old, err := os.ReadFile(f)
+			if err != nil {
+				return err
+			}
+			o.diff(f, old, nil)
+			continue
+		}
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+		if o.logOut != nil {
+			_, _ = fmt.Fprintln(o.logOut, "removed stale generated file", f)
+		}
+		// remove the directories left empty, os.Remove fails on non-empty ones
+		for dir := filepath.Dir(f); strings.HasPrefix(dir, o.outputDir+string(filepath.Separator)); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func isGeneratedFile(f string) (bool, error) {
+	bs, err := os.ReadFile(f)
+	if err != nil {
+		return false, err
+	}
+	// the header may follow a //go:build line
+	for _, line := range strings.Split(string(bs), "\n") {
+		if line == generatedHeader {
+			return true, nil
+		}
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+	}
+	return false, nil
+}
+
 func (o *option) generateHandler(handle HandleFunc, pkgs *packageImports) (string, error) {
 	handle.mergeMapping()
 	autoNameHandleResponse(&handle)
@@ -296,39 +598,67 @@ func (o *option) generateHandler(handle HandleFunc, pkgs *packageImports) (strin
 		pkgsCache[v.Path] = v
 	}
 
-L1:
-	for i, a := range handle.RequestArgs {
-
-		if p, ok := pkgsCache[a.Package.Path]; ok {
+	// aliasType renders the type of the arg with the aliases of the generated file
+	aliasType := func(a Arg) Arg {
+		if a.IsComposite() {
+			a.Type.PackageName = types.TypeString(a.elemType, func(p *types.Package) string {
+				if item, ok := pkgsCache[p.Path()]; ok && item.Alias != "" {
+					return item.Alias
+				}
+				return p.Name()
+			})
+		} else if p, ok := pkgsCache[a.Package.Path]; ok {
 			if p.Alias != "" {
-				handle.RequestArgs[i].Package = p
-				handle.RequestArgs[i].Type.PackageName = p.Alias + "." + a.Type.Name
+				a.Package = p
+				a.Type.PackageName = p.Alias + "." + a.Type.Name
 			}
 		}
+		return a
+	}
+	for i, a := range handle.ResponseResult {
+		handle.ResponseResult[i] = aliasType(a)
+	}
 
-		for _, t := range []string{"context.Context", "net/http.Request", "net/http.ResponseWriter"} {
-			if t == a.Type.FullName {
-				continue L1
-			}
-		}
+	for i, a := range handle.RequestArgs {
 
-		handle.RequestArgs[i].Location = "body"
+		handle.RequestArgs[i] = aliasType(a)
 
-		if _, ok := lo.Find(handle.With.BindQuery, func(item Type) bool { return item.EqualTo(a.Type) }); ok {
-			handle.RequestArgs[i].Location = "query"
-			continue
-		}
-		if _, ok := lo.Find(handle.With.BindHeader, func(item Type) bool { return item.EqualTo(a.Type) }); ok {
-			handle.RequestArgs[i].Location = "header"
-			continue
+		if a.Provider != nil {
+			provider := *a.Provider
+			if p, ok := pkgsCache[provider.Package.Path]; ok {
+				provider.Package = p
+			}
+			handle.RequestArgs[i].Provider = &provider
 		}
-		if a.Type.IsPrimitive() {
-			handle.RequestArgs[i].Location = "path"
-			if handle.PackageName == handle.RequestArgs[i].Name {
+
+		handle.RequestArgs[i].Location = handle.argLocation(a)
+		if handle.RequestArgs[i].Location == "path" {
+			if handle.RequestArgs[i].PathParamName == "" {
 				handle.RequestArgs[i].PathParamName = handle.RequestArgs[i].Name
+			}
+			if handle.PackageName == handle.RequestArgs[i].Name {
 				handle.RequestArgs[i].Name = generateVarName(handle.Name, "", handle.RequestArgs[i].PathParamName+"Param")
 			}
 		}
+		if handle.RequestArgs[i].Location == "file" {
+			handle.RequestArgs[i].FormField = handle.RequestArgs[i].Name
+		}
+		if handle.RequestArgs[i].shadowsTemplateName(handle.PackageName) {
+			handle.RequestArgs[i].Name = generateVarName(handle.Name, "", handle.RequestArgs[i].Name+"Arg")
+		}
+	}
+	for i, a := range handle.ResponseResult {
+		if a.Type.FullName != "error" && a.shadowsTemplateName(handle.PackageName) {
+			handle.ResponseResult[i].Name = generateVarName(handle.Name, "", a.Name+"Result")
+		}
+	}
+
+	for _, p := range handle.PathParams {
+		if p.Pattern == "" || !slices.Contains(handle.PathParamNames(), p.Name) {
+			continue
+		}
+		p.VarName = generateVarName(handle.GeneratedName(), "", p.Name+"Pattern")
+		handle.PathPatterns = append(handle.PathPatterns, p)
 	}
 
 	handle.RouteInfoPackage = aliasImportsPackage(pkgs.Imports, routeInfoPackage)
@@ -394,7 +724,11 @@ func autoNameHandleResponse(h *HandleFunc) {
 		if a.Name != "" {
 			continue
 		}
-		a.Name = generateVarName(h.Name, a.Type.Name, a.Name)
+		if i == 0 && h.StatusResult() != nil {
+			a.Name = generateVarName(h.Name, "", "status")
+		} else {
+			a.Name = generateVarName(h.Name, a.Type.Name, a.Name)
+		}
 		h.ResponseResult[i] = a
 	}
 }
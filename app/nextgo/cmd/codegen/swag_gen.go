@@ -2,14 +2,24 @@ package codegen
 
 import (
 	"encoding/json"
+	"go/types"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/go-openapi/spec"
+	"github.com/samber/lo"
 )
 
-func GenerateSwag(api *RestfulApi, outputDir string, templateDir string) error {
+func GenerateSwag(api *RestfulApi, outputDir string, templateDir string, opts ...GenerateOptionFunc) error {
+	o := newDefaultOption()
+	o.outputDir = outputDir
+	for _, f := range opts {
+		f(o)
+	}
+
 	// Create a new Swagger spec
 	swagger := spec.Swagger{
 		SwaggerProps: spec.SwaggerProps{
@@ -72,23 +82,83 @@ func GenerateSwag(api *RestfulApi, outputDir string, templateDir string) error {
 
 			// Add path parameters
 			for _, arg := range handler.RequestArgs {
-				if strings.Contains(path, "{"+arg.Name+"}") {
+				if name := arg.PathParamName; name != "" {
+					param := pathParameter(name, arg)
+					if p := handler.pathParam(name); p != nil {
+						if p.Format != "" {
+							param.Format = p.Format
+						}
+						param.Pattern = p.Pattern
+					}
+					operation.Parameters = append(operation.Parameters, *param)
+				}
+			}
+
+			// Add body parameters
+			for _, arg := range handler.RequestArgs {
+				if handler.argLocation(arg) == "body" {
 					param := spec.Parameter{
 						ParamProps: spec.ParamProps{
 							Name:     arg.Name,
-							In:       "path",
-							Required: true,
-							Schema:   schemaFromType(arg.Type),
+							In:       "body",
+							Required: !arg.Star || arg.Slice,
+							Schema:   schemaFromArg(arg, swagger.Definitions),
 						},
 					}
 					operation.Parameters = append(operation.Parameters, param)
 				}
 			}
 
+			// Add file parameters
+			for _, arg := range handler.RequestArgs {
+				if arg.IsFile() {
+					param := spec.Parameter{
+						ParamProps: spec.ParamProps{
+							Name: arg.Name,
+							In:   "formData",
+						},
+						SimpleSchema: spec.SimpleSchema{Type: "file"},
+					}
+					operation.Parameters = append(operation.Parameters, param)
+					operation.Consumes = []string{"multipart/form-data"}
+				}
+			}
+
+			// Add form parameters
+			for _, formType := range handler.With.BindForm {
+				if schema, ok := api.Schemas[formType.PackageName]; ok {
+					if len(operation.Consumes) == 0 {
+						operation.Consumes = []string{"application/x-www-form-urlencoded"}
+					}
+					for _, name := range sortedKeys(schema.Properties) {
+						prop := schema.Properties[name]
+						paramName := api.paramName(formType.PackageName, name, "form")
+						if paramName == "-" {
+							continue
+						}
+						param := spec.Parameter{
+							ParamProps: spec.ParamProps{
+								Name:     paramName,
+								In:       "formData",
+								Required: contains(schema.Required, name),
+								Schema:   &prop,
+							},
+						}
+						if isFileSchema(prop) {
+							param.Schema = nil
+							param.Type = "file"
+							operation.Consumes = []string{"multipart/form-data"}
+						}
+						operation.Parameters = append(operation.Parameters, param)
+					}
+				}
+			}
+
 			// Add query parameters
 			for _, queryType := range handler.With.BindQuery {
 				if schema, ok := api.Schemas[queryType.PackageName]; ok {
-					for name, prop := range schema.Properties {
+					for _, name := range sortedKeys(schema.Properties) {
+						prop := schema.Properties[name]
 						param := spec.Parameter{
 							ParamProps: spec.ParamProps{
 								Name:     name,
@@ -105,7 +175,8 @@ func GenerateSwag(api *RestfulApi, outputDir string, templateDir string) error {
 			// Add header parameters
 			for _, headerType := range handler.With.BindHeader {
 				if schema, ok := api.Schemas[headerType.PackageName]; ok {
-					for name, prop := range schema.Properties {
+					for _, name := range sortedKeys(schema.Properties) {
+						prop := schema.Properties[name]
 						param := spec.Parameter{
 							ParamProps: spec.ParamProps{
 								Name:     name,
@@ -119,12 +190,31 @@ func GenerateSwag(api *RestfulApi, outputDir string, templateDir string) error {
 				}
 			}
 
-			// Add responses
-			statusCode := handler.With.HttpCode
-			if statusCode == 0 {
-				statusCode = 200
+			// Add cookie parameters
+			for _, cookieType := range handler.With.BindCookie {
+				if schema, ok := api.Schemas[cookieType.PackageName]; ok {
+					for _, name := range sortedKeys(schema.Properties) {
+						prop := schema.Properties[name]
+						paramName := api.paramName(cookieType.PackageName, name, "cookie")
+						if paramName == "-" {
+							continue
+						}
+						param := spec.Parameter{
+							ParamProps: spec.ParamProps{
+								Name:     paramName,
+								In:       "cookie",
+								Required: contains(schema.Required, name),
+								Schema:   &prop,
+							},
+						}
+						operation.Parameters = append(operation.Parameters, param)
+					}
+				}
 			}
 
+			// Add responses
+			statusCode := handler.SuccessStatusCode()
+
 			response := spec.Response{
 				ResponseProps: spec.ResponseProps{
 					Description: "Successful operation",
@@ -132,8 +222,8 @@ func GenerateSwag(api *RestfulApi, outputDir string, templateDir string) error {
 			}
 
 			// Add response schema if available
-			if len(handler.ResponseResult) > 0 {
-				response.Schema = schemaFromType(handler.ResponseResult[0].Type)
+			if body := handler.ResponseBody(); len(body) > 0 {
+				response.Schema = schemaFromArg(body[0], swagger.Definitions)
 			}
 
 			operation.Responses.StatusCodeResponses[statusCode] = response
@@ -157,10 +247,28 @@ func GenerateSwag(api *RestfulApi, outputDir string, templateDir string) error {
 			}
 		}
 
-		swagger.Paths.Paths[path] = pathItem
+		// swagger has no catch-all parameter, {rest...} is documented as {rest}
+		swagger.Paths.Paths[strings.ReplaceAll(path, "...}", "}")] = pathItem
 	}
 
-	return os.WriteFile(filepath.Join(outputDir, "swagger.json"), []byte(Beautify(swagger)), 0664)
+	if err := o.output(filepath.Join(outputDir, "swagger.json"), []byte(Beautify(swagger))); err != nil {
+		return err
+	}
+	return o.checkResult()
+}
+
+// paramName returns the name the codec decodes the property prop of typeName
+// from, the name in the tag key of the field or else the field name, "-" if
+// the codec skips the field
+func (api *RestfulApi) paramName(typeName, prop, key string) string {
+	field, ok := api.Fields[typeName][prop]
+	if !ok {
+		return prop
+	}
+	if name := field.Tags[key]; name != "" {
+		return name
+	}
+	return field.Name
 }
 
 // Helper function to create a schema from a Type
@@ -190,6 +298,125 @@ func schemaFromType(t Type) *spec.Schema {
 	return spec.RefSchema("#/definitions/" + t.PackageName)
 }
 
+// Helper function to create a path parameter, types decoded with UnmarshalText are strings
+func pathParameter(name string, a Arg) *spec.Parameter {
+	param := spec.PathParam(name).Typed("string", "")
+	if a.elemType == nil || !isPathType(a) || isTextUnmarshaler(a.elemType) {
+		return param
+	}
+	if schema := schemaFromGoType(a.elemType, map[string]spec.Schema{}); len(schema.Type) == 1 && schema.Type[0] != "object" {
+		return param.Typed(schema.Type[0], schema.Format)
+	}
+	return param
+}
+
+// Helper function to create a schema from an Arg, resolved through go/types when available
+func schemaFromArg(a Arg, definitions map[string]spec.Schema) *spec.Schema {
+	if a.GoType == nil {
+		return schemaFromType(a.Type)
+	}
+	return schemaFromGoType(responseBodyType(a.GoType), definitions)
+}
+
+// Helper function to unwrap the body type T of nextgo http.Response[T] results
+func responseBodyType(t types.Type) types.Type {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.TypeArgs().Len() != 1 {
+		return t
+	}
+	if obj := named.Obj(); obj.Pkg() != nil && obj.Pkg().Path() == routeInfoPackage.Path && obj.Name() == "Response" {
+		return named.TypeArgs().At(0)
+	}
+	return t
+}
+
+// Helper function to create a schema from a go/types type. Slices become array
+// items, maps additionalProperties, and structs missing from definitions, such
+// as instantiated generics like Page[TodoItem], are added to definitions.
+func schemaFromGoType(t types.Type, definitions map[string]spec.Schema) *spec.Schema {
+	switch t := types.Unalias(t).(type) {
+	case *types.Pointer:
+		return schemaFromGoType(t.Elem(), definitions)
+	case *types.Slice:
+		if b, ok := t.Elem().(*types.Basic); ok && b.Kind() == types.Byte {
+			return &spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{"string"}, Format: "binary"}}
+		}
+		return spec.ArrayProperty(schemaFromGoType(t.Elem(), definitions))
+	case *types.Array:
+		return spec.ArrayProperty(schemaFromGoType(t.Elem(), definitions))
+	case *types.Map:
+		return spec.MapProperty(schemaFromGoType(t.Elem(), definitions))
+	case *types.Basic:
+		return schemaFromType(Type{Name: t.Name()})
+	case *types.Named:
+		if obj := t.Obj(); obj.Pkg() != nil && obj.Pkg().Path() == "time" && obj.Name() == "Time" {
+			return spec.DateTimeProperty()
+		}
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			return schemaFromGoType(t.Underlying(), definitions)
+		}
+		name := definitionName.Replace(types.TypeString(t, func(p *types.Package) string { return p.Name() }))
+		if _, ok := definitions[name]; !ok {
+			// placeholder first, the struct may refer to itself
+			definitions[name] = spec.Schema{}
+			definitions[name] = structSchema(st, definitions)
+		}
+		return spec.RefSchema("#/definitions/" + name)
+	}
+	return &spec.Schema{}
+}
+
+// definitionName keeps instantiated generic names such as todos.Page[todos.Item]
+// free of characters that would need escaping in a $ref
+var definitionName = strings.NewReplacer("[", "-", "]", "", ", ", "_", ",", "_", " ", "")
+
+// Helper function to create an object schema from struct fields
+func structSchema(st *types.Struct, definitions map[string]spec.Schema) spec.Schema {
+	schema := spec.Schema{
+		SchemaProps: spec.SchemaProps{
+			Type:       []string{"object"},
+			Properties: make(map[string]spec.Schema),
+		},
+	}
+	for i := 0; i < st.NumFields(); i++ {
+		field := st.Field(i)
+		if !field.Exported() {
+			continue
+		}
+		tags := parseStructTags(st.Tag(i))
+		name := field.Name()
+		if n, ok := tags["json"]; ok {
+			name = n
+		} else if reflect.StructTag(st.Tag(i)).Get("json") == "-" {
+			continue
+		}
+		schema.Properties[name] = *schemaFromGoType(field.Type(), definitions)
+		if strings.Contains(tags["validate"], "required") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	return schema
+}
+
+// Helper function to check if a schema describes a *multipart.FileHeader or []*multipart.FileHeader
+func isFileSchema(schema spec.Schema) bool {
+	if schema.Items != nil && schema.Items.Schema != nil {
+		schema = *schema.Items.Schema
+	}
+	return schema.Ref.String() == "#/definitions/multipart.FileHeader"
+}
+
+// Helper function to get the keys of a map in order, keeping the output stable
+func sortedKeys[V any](m map[string]V) []string {
+	keys := lo.Keys(m)
+	slices.Sort(keys)
+	return keys
+}
+
 // Helper function to check if a string is in a slice
 func contains(slice []string, str string) bool {
 	for _, s := range slice {
@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"os"
 	"path/filepath"
 
 	"github.com/spf13/cobra"
@@ -20,6 +21,8 @@ func init() {
 	swagCodegenCmd.PersistentFlags().StringVar(&src, "src", "", "your api dir")
 	swagCodegenCmd.PersistentFlags().StringVar(&swgOutput, "out", "", "the output dir of swagger doc")
 	swagCodegenCmd.PersistentFlags().StringVar(&templateOutput, "template", "", "the template of swagger doc")
+	swagCodegenCmd.PersistentFlags().BoolVar(&check, "check", false, "print a diff and exit non-zero if the swagger doc is out of date, without writing")
+	addParseFlags(swagCodegenCmd)
 }
 
 var swagCodegenCmd = &cobra.Command{
@@ -29,13 +32,15 @@ var swagCodegenCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 
 		src, _ = filepath.Abs(src)
-		apis, err := codegen2.Parse(src)
-		if err != nil {
-			log.Fatalln(err)
+		apis := parseApi(src)
+
+		var opts []codegen2.GenerateOptionFunc
+		if check {
+			opts = append(opts, codegen2.WithCheck(os.Stdout))
 		}
 
 		outputDir, _ := filepath.Abs(swgOutput)
-		if err := codegen2.GenerateSwag(apis, outputDir, templateOutput); err != nil {
+		if err := codegen2.GenerateSwag(apis, outputDir, templateOutput, opts...); err != nil {
 			log.Fatalln(fmt.Errorf("generate swagger failed: %v", err))
 		}
 	},
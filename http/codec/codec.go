@@ -1,8 +1,16 @@
 package codec
 
 import (
+	"encoding"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/schema"
 )
@@ -22,7 +30,8 @@ type Codec interface {
 	Decode(req *http.Request, val any) error
 
 	// DecodePath decodes the `name` parameter from the request path.
-	// The `val` type must be a pointer to a string or a number.
+	// The `val` type must be a pointer to a string, a number, a bool
+	// or an encoding.TextUnmarshaler.
 	// Example:
 	// For a request: /api/v1/users/{id}
 	//	var id int
@@ -59,6 +68,44 @@ type Codec interface {
 	//	fmt.Println("Filter:", filter)
 	DecodeHeader(*http.Request, any) error
 
+	// DecodeCookie parses the request cookies into the specified value.
+	// Example:
+	//	type Session struct {
+	//		ID string `cookie:"session_id"`
+	//	}
+	//	var session Session
+	//	err := codec.DecodeCookie(req, &session)
+	//	if err != nil {
+	//		// Handle error
+	//	}
+	//	fmt.Println("Session:", session.ID)
+	DecodeCookie(*http.Request, any) error
+
+	// DecodeForm parses a `multipart/form-data` or `application/x-www-form-urlencoded`
+	// request body into the specified value. Fields of type *multipart.FileHeader
+	// or []*multipart.FileHeader are filled from the uploaded files.
+	// Example:
+	//	type Upload struct {
+	//		Title  string                `form:"title"`
+	//		Avatar *multipart.FileHeader `form:"avatar"`
+	//	}
+	//	var upload Upload
+	//	err := codec.DecodeForm(req, &upload)
+	//	if err != nil {
+	//		// Handle error
+	//	}
+	DecodeForm(*http.Request, any) error
+
+	// DecodeFile decodes the uploaded file(s) of the `name` form field.
+	// The `val` type must be a **multipart.FileHeader or a *[]*multipart.FileHeader.
+	// Example:
+	//	var avatar *multipart.FileHeader
+	//	err := codec.DecodeFile(req, "avatar", &avatar)
+	//	if err != nil {
+	//		// Handle error
+	//	}
+	DecodeFile(req *http.Request, name string, val any) error
+
 	// Encode serializes the specified value and writes it to the response body.
 	// Example:
 	//	data := map[string]string{"status": "success"}
@@ -68,6 +115,16 @@ type Codec interface {
 	//	}
 	Encode(http.ResponseWriter, any) error
 
+	// EncodeStatus writes the status code and then serializes the specified value
+	// to the response body. No body is written for a nil value or 204 No Content.
+	// Example:
+	//	data := map[string]string{"id": "1"}
+	//	err := codec.EncodeStatus(w, http.StatusCreated, data)
+	//	if err != nil {
+	//		// Handle error
+	//	}
+	EncodeStatus(w http.ResponseWriter, statusCode int, val any) error
+
 	// EncodeError serializes the error and writes it to the response body.
 	// Example:
 	//	err := errors.New("something went wrong")
@@ -80,7 +137,11 @@ type codec struct {
 	decodePath   func(req *http.Request, name string, val any) error
 	decodeQuery  func(*http.Request, any) error
 	decodeHeader func(*http.Request, any) error
+	decodeCookie func(*http.Request, any) error
+	decodeForm   func(*http.Request, any) error
+	decodeFile   func(req *http.Request, name string, val any) error
 	encode       func(http.ResponseWriter, any) error
+	encodeStatus func(w http.ResponseWriter, statusCode int, val any) error
 	encodeError  func(http.ResponseWriter, error) error
 }
 
@@ -100,10 +161,26 @@ func (c *codec) DecodeHeader(request *http.Request, a any) error {
 	return c.decodeHeader(request, a)
 }
 
+func (c *codec) DecodeCookie(request *http.Request, a any) error {
+	return c.decodeCookie(request, a)
+}
+
+func (c *codec) DecodeForm(request *http.Request, a any) error {
+	return c.decodeForm(request, a)
+}
+
+func (c *codec) DecodeFile(req *http.Request, name string, val any) error {
+	return c.decodeFile(req, name, val)
+}
+
 func (c *codec) Encode(writer http.ResponseWriter, a any) error {
 	return c.encode(writer, a)
 }
 
+func (c *codec) EncodeStatus(writer http.ResponseWriter, statusCode int, a any) error {
+	return c.encodeStatus(writer, statusCode, a)
+}
+
 func (c *codec) EncodeError(writer http.ResponseWriter, err error) error {
 	return c.encodeError(writer, err)
 }
@@ -126,12 +203,36 @@ func WithQueryDecode(f func(*http.Request, any) error) func(c *codec) {
 	}
 }
 
+func WithCookieDecode(f func(*http.Request, any) error) func(c *codec) {
+	return func(c *codec) {
+		c.decodeCookie = f
+	}
+}
+
+func WithFormDecode(f func(*http.Request, any) error) func(c *codec) {
+	return func(c *codec) {
+		c.decodeForm = f
+	}
+}
+
+func WithFileDecode(f func(req *http.Request, name string, val any) error) func(c *codec) {
+	return func(c *codec) {
+		c.decodeFile = f
+	}
+}
+
 func WithEncode(f func(http.ResponseWriter, any) error) func(c *codec) {
 	return func(c *codec) {
 		c.encode = f
 	}
 }
 
+func WithStatusEncode(f func(w http.ResponseWriter, statusCode int, val any) error) func(c *codec) {
+	return func(c *codec) {
+		c.encodeStatus = f
+	}
+}
+
 func EncodeError(f func(http.ResponseWriter, error) error) func(c *codec) {
 	return func(c *codec) {
 		c.encodeError = f
@@ -146,6 +247,9 @@ func New(opts ...CodeCOption) Codec {
 	for _, opt := range opts {
 		opt(c)
 	}
+	if c.encodeStatus == nil {
+		c.encodeStatus = c.defaultEncodeStatus
+	}
 	return c
 }
 
@@ -155,21 +259,139 @@ func defaultCodec() *codec {
 		decodePath:   defaultDecodePath,
 		decodeQuery:  defaultDecodeQuery,
 		decodeHeader: defaultDecodeHeader,
+		decodeCookie: defaultDecodeCookie,
+		decodeForm:   defaultDecodeForm,
+		decodeFile:   defaultDecodeFile,
 		encode:       defaultEncode,
 		encodeError:  defaultEncodeError,
 	}
 }
 
 func defaultDecode(req *http.Request, val any) error {
-	return json.NewDecoder(req.Body).Decode(val)
+	if err := json.NewDecoder(req.Body).Decode(val); err != nil {
+		return newRequestError("INVALID_BODY", "invalid request body", err)
+	}
+	return nil
 }
 
+// defaultDecodePath reads the path value matched by http.ServeMux (Go 1.22+),
+// an empty value keeps the zero value of val.
 func defaultDecodePath(req *http.Request, name string, val any) error {
+	value := req.PathValue(name)
+	if value == "" {
+		return nil
+	}
+	if err := decodeString(value, val); err != nil {
+		return &pathParamError{name: name, value: value, err: err}
+	}
+	return nil
+}
+
+// pathParamError is reported as 400 Bad Request by the default codec
+type pathParamError struct {
+	name  string
+	value string
+	err   error
+}
+
+func (e *pathParamError) Error() string {
+	return fmt.Sprintf("invalid path parameter %s: %q", e.name, e.value)
+}
+
+func (e *pathParamError) Unwrap() error {
+	return e.err
+}
+
+func (e *pathParamError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+func (e *pathParamError) ErrorCode() string {
+	return "INVALID_PATH_PARAM"
+}
+
+// requestError is a malformed request reported as 400 Bad Request by the
+// default codec, e.g. a body that isn't valid JSON
+type requestError struct {
+	code string
+	msg  string
+	err  error
+}
+
+// newRequestError wraps an error of a default decoder, errors already carrying
+// a status code, e.g. returned by a TextUnmarshaler, are kept as is
+func newRequestError(code, msg string, err error) error {
+	var sc statusCoder
+	if errors.As(err, &sc) {
+		return err
+	}
+	return &requestError{code: code, msg: msg, err: err}
+}
+
+func (e *requestError) Error() string {
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+func (e *requestError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+func (e *requestError) ErrorCode() string {
+	return e.code
+}
+
+// decodeString converts s into the value val points to
+func decodeString(s string, val any) error {
+	if u, ok := val.(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return fmt.Errorf("expect a non-nil pointer, but got: %T", val)
+	}
+	v = v.Elem()
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported path parameter type: %T", val)
+	}
 	return nil
 }
 
 var headerDecoder = schema.NewDecoder()
 var queryDecoder = schema.NewDecoder()
+var cookieDecoder = schema.NewDecoder()
+var formDecoder = schema.NewDecoder()
 
 func init() {
 	for _, decoder := range []*schema.Decoder{headerDecoder, queryDecoder} {
@@ -177,25 +399,237 @@ func init() {
 		decoder.ZeroEmpty(true)
 		decoder.SetAliasTag("header")
 	}
+	cookieDecoder.IgnoreUnknownKeys(true)
+	cookieDecoder.ZeroEmpty(true)
+	cookieDecoder.SetAliasTag("cookie")
+	formDecoder.IgnoreUnknownKeys(true)
+	formDecoder.ZeroEmpty(true)
+	formDecoder.SetAliasTag("form")
 }
 
 func defaultDecodeQuery(req *http.Request, val any) error {
-	return queryDecoder.Decode(val, req.URL.Query())
+	if err := queryDecoder.Decode(val, req.URL.Query()); err != nil {
+		return newRequestError("INVALID_QUERY", "invalid query", err)
+	}
+	return nil
 }
 
 func defaultDecodeHeader(req *http.Request, val any) error {
-	return headerDecoder.Decode(val, req.Header)
+	if err := headerDecoder.Decode(val, req.Header); err != nil {
+		return newRequestError("INVALID_HEADER", "invalid header", err)
+	}
+	return nil
 }
 
-func defaultEncode(w http.ResponseWriter, val any) error {
-	return json.NewEncoder(w).Encode(val)
+func defaultDecodeCookie(req *http.Request, val any) error {
+	values := map[string][]string{}
+	for _, c := range req.Cookies() {
+		values[c.Name] = append(values[c.Name], c.Value)
+	}
+	if err := cookieDecoder.Decode(val, values); err != nil {
+		return newRequestError("INVALID_COOKIE", "invalid cookie", err)
+	}
+	return nil
 }
 
-func defaultEncodeError(w http.ResponseWriter, err error) error {
+// defaultMaxMemory is the maximum bytes of a multipart form kept in memory,
+// the same as net/http uses for Request.FormFile.
+const defaultMaxMemory = 32 << 20
+
+var (
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	fileHeaderSliceType = reflect.TypeOf([]*multipart.FileHeader(nil))
+)
 
-	w.WriteHeader(http.StatusInternalServerError)
-	if _, err := w.Write([]byte(err.Error())); err != nil {
+func parseForm(req *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	var err error
+	if mediaType == "multipart/form-data" {
+		err = req.ParseMultipartForm(defaultMaxMemory)
+	} else {
+		err = req.ParseForm()
+	}
+	if err != nil {
+		return newRequestError("INVALID_FORM", "invalid form", err)
+	}
+	return nil
+}
+
+func formFiles(req *http.Request, name string) []*multipart.FileHeader {
+	if req.MultipartForm == nil {
+		return nil
+	}
+	return req.MultipartForm.File[name]
+}
+
+func defaultDecodeForm(req *http.Request, val any) error {
+	if err := parseForm(req); err != nil {
 		return err
 	}
+	if err := formDecoder.Decode(val, req.PostForm); err != nil {
+		return newRequestError("INVALID_FORM", "invalid form", err)
+	}
+
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		files := formFiles(req, name)
+		switch field.Type {
+		case fileHeaderType:
+			if len(files) > 0 {
+				v.Field(i).Set(reflect.ValueOf(files[0]))
+			}
+		case fileHeaderSliceType:
+			v.Field(i).Set(reflect.ValueOf(files))
+		}
+	}
 	return nil
 }
+
+func defaultDecodeFile(req *http.Request, name string, val any) error {
+	if err := parseForm(req); err != nil {
+		return err
+	}
+	files := formFiles(req, name)
+	switch v := val.(type) {
+	case **multipart.FileHeader:
+		if len(files) > 0 {
+			*v = files[0]
+		}
+	case *[]*multipart.FileHeader:
+		*v = files
+	default:
+		return fmt.Errorf("unsupported file type: %T", val)
+	}
+	return nil
+}
+
+func defaultEncode(w http.ResponseWriter, val any) error {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	return json.NewEncoder(w).Encode(val)
+}
+
+// defaultEncodeStatus delegates the body to the configured encode func, so a
+// custom WithEncode keeps working. The status code is written with the first
+// byte of the body, headers set by the encode func are not dropped.
+func (c *codec) defaultEncodeStatus(w http.ResponseWriter, statusCode int, val any) error {
+	if val == nil || statusCode == http.StatusNoContent {
+		w.WriteHeader(statusCode)
+		return nil
+	}
+	sw := &statusWriter{ResponseWriter: w, statusCode: statusCode}
+	err := c.encode(sw, val)
+	if !sw.wroteHeader {
+		sw.WriteHeader(statusCode)
+	}
+	return err
+}
+
+// statusWriter defers writing the status code until the body is written
+type statusWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(w.statusCode)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(w.statusCode)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// statusCoder is implemented by errors carrying an HTTP status code,
+// such as *github.com/headless-go/nextgo/http.Error.
+type statusCoder interface {
+	StatusCode() int
+}
+
+type errorCoder interface {
+	ErrorCode() string
+}
+
+type errorDetailer interface {
+	ErrorDetails() any
+}
+
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type    string `json:"type,omitempty"`
+	Title   string `json:"title"`
+	Status  int    `json:"status"`
+	Detail  string `json:"detail,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+// NewProblem converts err to a Problem. Errors without a status code are
+// reported as a generic 500 so internal messages never reach clients.
+func NewProblem(err error) Problem {
+	var sc statusCoder
+	if !errors.As(err, &sc) {
+		return Problem{
+			Title:  http.StatusText(http.StatusInternalServerError),
+			Status: http.StatusInternalServerError,
+		}
+	}
+
+	p := Problem{
+		Title:  http.StatusText(sc.StatusCode()),
+		Status: sc.StatusCode(),
+	}
+	if e, ok := sc.(error); ok {
+		p.Detail = e.Error()
+	}
+	var ec errorCoder
+	if errors.As(err, &ec) {
+		p.Code = ec.ErrorCode()
+	}
+	var ed errorDetailer
+	if errors.As(err, &ed) {
+		p.Details = ed.ErrorDetails()
+	}
+	return p
+}
+
+func defaultEncodeError(w http.ResponseWriter, err error) error {
+
+	p := NewProblem(err)
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	return json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,124 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error is an error carrying an HTTP status code, a machine readable code and
+// optional details. Handlers can return it to control the error response, the
+// default codec renders it as an RFC 7807 `application/problem+json` body.
+// Example:
+//
+//	return nil, http.NewError(http.StatusNotFound, "TODO_NOT_FOUND", "todo %s not found", id)
+type Error struct {
+	// Status is the HTTP status code, 500 if zero
+	Status int
+	// Code is a machine readable error code, e.g. TODO_NOT_FOUND
+	Code string
+	// Message is the human readable explanation sent to clients
+	Message string
+	// Details holds extra data such as field validation errors
+	Details any
+	// Err is the underlying cause, never sent to clients
+	Err error
+}
+
+// NewError returns an Error with the status, code and formatted message
+func NewError(status int, code string, format string, a ...any) *Error {
+	return &Error{
+		Status:  status,
+		Code:    code,
+		Message: fmt.Sprintf(format, a...),
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return e.Message
+	}
+	if e.Code != "" {
+		return e.Code
+	}
+	return http.StatusText(e.StatusCode())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status code of the error
+func (e *Error) StatusCode() int {
+	if e.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return e.Status
+}
+
+// ErrorCode returns the machine readable error code
+func (e *Error) ErrorCode() string {
+	return e.Code
+}
+
+// ErrorDetails returns the extra details of the error
+func (e *Error) ErrorDetails() any {
+	return e.Details
+}
+
+// WithDetails returns a copy of the error with details
+func (e *Error) WithDetails(details any) *Error {
+	n := *e
+	n.Details = details
+	return &n
+}
+
+// Wrap returns a copy of the error with the underlying cause
+func (e *Error) Wrap(err error) *Error {
+	n := *e
+	n.Err = err
+	return &n
+}
+
+// ErrBadRequest returns a 400 Error
+func ErrBadRequest(code string, format string, a ...any) *Error {
+	return NewError(http.StatusBadRequest, code, format, a...)
+}
+
+// ErrUnauthorized returns a 401 Error
+func ErrUnauthorized(code string, format string, a ...any) *Error {
+	return NewError(http.StatusUnauthorized, code, format, a...)
+}
+
+// ErrForbidden returns a 403 Error
+func ErrForbidden(code string, format string, a ...any) *Error {
+	return NewError(http.StatusForbidden, code, format, a...)
+}
+
+// ErrNotFound returns a 404 Error
+func ErrNotFound(code string, format string, a ...any) *Error {
+	return NewError(http.StatusNotFound, code, format, a...)
+}
+
+// ErrConflict returns a 409 Error
+func ErrConflict(code string, format string, a ...any) *Error {
+	return NewError(http.StatusConflict, code, format, a...)
+}
+
+// ErrUnprocessableEntity returns a 422 Error, e.g. for validation failures
+func ErrUnprocessableEntity(code string, format string, a ...any) *Error {
+	return NewError(http.StatusUnprocessableEntity, code, format, a...)
+}
+
+// validationError reports an error of the Validator as a 422 Error with code
+// VALIDATION_FAILED, errors already carrying a status code are kept as is
+func validationError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		return err
+	}
+	return ErrUnprocessableEntity("VALIDATION_FAILED", "validation failed: %s", err).Wrap(err)
+}
@@ -0,0 +1,85 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// WithIntrospection serves the routes added to the option as JSON at GET pattern
+// on the server of the generated Handle. The endpoint exposes the whole api, so
+// protect is required, e.g. a middleware checking an admin token. Routes are
+// filtered by label with ?label=key or ?label=key=value, repeated labels must
+// all match.
+// Example:
+//
+//	generated.Handle(svr, generated.WithOption(http.WithIntrospection("/_nextgo/routes", adminOnly)))
+func WithIntrospection(pattern string, protect func(http.Handler) http.Handler) OptionFunc {
+	if protect == nil {
+		panic(fmt.Sprintf("nextgo: WithIntrospection %s requires a middleware protecting the endpoint", pattern))
+	}
+	return func(opt *option) {
+		opt.introspection = &introspection{pattern: pattern, protect: protect}
+	}
+}
+
+type introspection struct {
+	pattern string
+	protect func(http.Handler) http.Handler
+}
+
+// introspectedRoute is the JSON description of a route
+type introspectedRoute struct {
+	Method     string            `json:"method"`
+	Pattern    string            `json:"pattern"`
+	PathPrefix bool              `json:"path_prefix,omitempty"`
+	PathParam  []string          `json:"path_param,omitempty"`
+	Label      map[string]string `json:"label,omitempty"`
+	Middleware []string          `json:"middleware"`
+	Handler    string            `json:"handler"`
+	StatusCode int               `json:"status_code,omitempty"`
+	Desc       string            `json:"desc,omitempty"`
+}
+
+func (i *introspection) handler(o *option) http.Handler {
+	return i.protect(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		filters := req.URL.Query()["label"]
+		routes := make([]introspectedRoute, 0)
+		for _, r := range o.Routes() {
+			if !matchLabels(r.Label, filters) {
+				continue
+			}
+			routes = append(routes, introspectedRoute{
+				Method:     r.HTTPMethod,
+				Pattern:    r.Patten,
+				PathPrefix: r.PathPrefix,
+				PathParam:  r.PathParam,
+				Label:      r.Label,
+				Middleware: r.Middleware,
+				Handler:    r.HandleFunc,
+				StatusCode: r.StatusCode,
+				Desc:       r.Desc,
+			})
+		}
+		slices.SortFunc(routes, func(a, b introspectedRoute) int {
+			if c := strings.Compare(a.Pattern, b.Pattern); c != 0 {
+				return c
+			}
+			return strings.Compare(a.Method, b.Method)
+		})
+		_ = o.EncodeStatus(rw, http.StatusOK, routes)
+	}))
+}
+
+// matchLabels reports whether labels match every key or key=value filter
+func matchLabels(labels map[string]string, filters []string) bool {
+	for _, f := range filters {
+		key, value, hasValue := strings.Cut(f, "=")
+		v, ok := labels[key]
+		if !ok || hasValue && v != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,204 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// DefaultDurationBuckets are the upper bounds in seconds of the request duration histogram
+	DefaultDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultSizeBuckets are the upper bounds in bytes of the request and response size histograms
+	DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+var _ Observer = (*Metrics)(nil)
+var _ http.Handler = (*Metrics)(nil)
+
+// Metrics is an Observer keeping Prometheus histograms of the request duration,
+// request size and response size, and a counter of errors. Series are labeled
+// by method and route pattern, never the raw path, and by the RouteInfo.Label
+// keys given to NewMetrics. ServeHTTP writes them in the Prometheus text format.
+// Example:
+//
+//	metrics := http.NewMetrics("tag")
+//	generated.Handle(svr, generated.WithOption(http.WithObserver(metrics)))
+//	mux.Handle("/metrics", metrics)
+type Metrics struct {
+	labelKeys  []string
+	labelNames []string
+
+	mu           sync.Mutex
+	duration     *histogramVec
+	requestSize  *histogramVec
+	responseSize *histogramVec
+	errors       map[string]*counter
+}
+
+// NewMetrics returns Metrics labeled by the RouteInfo.Label keys, the label
+// names are the keys with characters invalid in Prometheus replaced by _,
+// prefixed with label_ if taken by method, route or status or starting with
+// the reserved __. It panics on an empty key or keys mapped to the same name,
+// Prometheus rejects a scrape with duplicate label names.
+func NewMetrics(labelKeys ...string) *Metrics {
+	m := &Metrics{
+		labelKeys:    labelKeys,
+		labelNames:   []string{"method", "route", "status"},
+		duration:     newHistogramVec("nextgo_http_request_duration_seconds", "Duration of the requests in seconds.", DefaultDurationBuckets),
+		requestSize:  newHistogramVec("nextgo_http_request_size_bytes", "Size of the request bodies in bytes.", DefaultSizeBuckets),
+		responseSize: newHistogramVec("nextgo_http_response_size_bytes", "Size of the response bodies in bytes.", DefaultSizeBuckets),
+		errors:       map[string]*counter{},
+	}
+	for _, key := range labelKeys {
+		if key == "" {
+			panic("nextgo: NewMetrics label key must not be empty")
+		}
+		name := metricLabelName(key)
+		if slices.Contains(m.labelNames[:3], name) || strings.HasPrefix(name, "__") {
+			name = "label_" + name
+		}
+		if slices.Contains(m.labelNames, name) {
+			panic(fmt.Sprintf("nextgo: NewMetrics label key %q maps to the label name %s already in use", key, name))
+		}
+		m.labelNames = append(m.labelNames, name)
+	}
+	return m
+}
+
+func (m *Metrics) Observe(_ *http.Request, o Observation) {
+	values := []string{"", "", strconv.Itoa(o.Status)}
+	if o.Route != nil {
+		values[0], values[1] = o.Route.HTTPMethod, o.Route.Patten
+		for _, key := range m.labelKeys {
+			values = append(values, o.Route.Label[key])
+		}
+	} else {
+		values = append(values, make([]string, len(m.labelKeys))...)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.duration.observe(values, o.Duration.Seconds())
+	m.requestSize.observe(values, float64(o.RequestSize))
+	m.responseSize.observe(values, float64(o.ResponseSize))
+	if o.Err != nil {
+		key := strings.Join(values, "\xff")
+		c, ok := m.errors[key]
+		if !ok {
+			c = &counter{labels: values}
+			m.errors[key] = c
+		}
+		c.value++
+	}
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w := bufio.NewWriter(rw)
+
+	m.mu.Lock()
+	m.duration.write(w, m.labelNames)
+	m.requestSize.write(w, m.labelNames)
+	m.responseSize.write(w, m.labelNames)
+	fmt.Fprintln(w, "# HELP nextgo_http_request_errors_total Number of requests responded with an encoded error.")
+	fmt.Fprintln(w, "# TYPE nextgo_http_request_errors_total counter")
+	for _, key := range sortedKeys(m.errors) {
+		c := m.errors[key]
+		fmt.Fprintf(w, "nextgo_http_request_errors_total{%s} %d\n", metricLabels(m.labelNames, c.labels), c.value)
+	}
+	m.mu.Unlock()
+
+	_ = w.Flush()
+}
+
+type counter struct {
+	labels []string
+	value  uint64
+}
+
+type histogram struct {
+	labels []string
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// histogramVec holds the histograms of a metric by label values
+type histogramVec struct {
+	name    string
+	help    string
+	buckets []float64
+	series  map[string]*histogram
+}
+
+func newHistogramVec(name, help string, buckets []float64) *histogramVec {
+	return &histogramVec{name: name, help: help, buckets: buckets, series: map[string]*histogram{}}
+}
+
+func (v *histogramVec) observe(labels []string, value float64) {
+	key := strings.Join(labels, "\xff")
+	h, ok := v.series[key]
+	if !ok {
+		h = &histogram{labels: labels, counts: make([]uint64, len(v.buckets))}
+		v.series[key] = h
+	}
+	for i, upper := range v.buckets {
+		if value <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (v *histogramVec) write(w *bufio.Writer, labelNames []string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", v.name)
+	for _, key := range sortedKeys(v.series) {
+		h := v.series[key]
+		labels := metricLabels(labelNames, h.labels)
+		for i, upper := range v.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", v.name, labels, strconv.FormatFloat(upper, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", v.name, labels, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", v.name, labels, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", v.name, labels, h.count)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// metricLabels formats the label pairs of a series, name="value",...
+func metricLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelValueEscaper.Replace(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricLabelName replaces the characters of key invalid in a Prometheus label name
+func metricLabelName(key string) string {
+	b := []byte(key)
+	for i, c := range b {
+		if !(c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
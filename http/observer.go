@@ -0,0 +1,151 @@
+package http
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Observation describes a served request of a generated route
+type Observation struct {
+	Route *RouteInfo
+	// Status is the status code written, 200 if the handler wrote none
+	Status   int
+	Duration time.Duration
+	// RequestSize is the number of body bytes read from the request
+	RequestSize int64
+	// ResponseSize is the number of body bytes written to the response
+	ResponseSize int64
+	// Err is the last error encoded with Option.EncodeError, from the handler,
+	// a provider or a decoder, nil for successful requests
+	Err error
+}
+
+// Observer is called after each request of the routes of the option, it must be
+// safe for concurrent use
+type Observer interface {
+	Observe(req *http.Request, o Observation)
+}
+
+// ObserverFunc adapts a function to Observer
+type ObserverFunc func(req *http.Request, o Observation)
+
+func (f ObserverFunc) Observe(req *http.Request, o Observation) {
+	f(req, o)
+}
+
+// WithObserver adds observers called for each request, e.g. NewMetrics
+func WithObserver(observers ...Observer) OptionFunc {
+	return func(opt *option) {
+		opt.observers = append(opt.observers, observers...)
+	}
+}
+
+// ObserveRoute returns the middleware calling the observers of opt for the
+// requests of route, generated handlers add it in front of the route
+// middlewares. It passes requests through if there is no observer.
+func ObserveRoute(opt Option, route *RouteInfo) func(http.Handler) http.Handler {
+	o, ok := opt.(*option)
+	if !ok || len(o.observers) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			start := time.Now()
+			w := &observedWriter{ResponseWriter: rw}
+			var body *countingReader
+			if req.Body != nil && req.Body != http.NoBody {
+				body = &countingReader{ReadCloser: req.Body}
+				req.Body = body
+			}
+
+			next.ServeHTTP(w, req)
+
+			obs := Observation{
+				Route:        route,
+				Status:       w.status,
+				Duration:     time.Since(start),
+				ResponseSize: w.size,
+				Err:          w.err,
+			}
+			if obs.Status == 0 {
+				obs.Status = http.StatusOK
+			}
+			if body != nil {
+				obs.RequestSize = body.n
+			}
+			for _, observer := range o.observers {
+				observer.Observe(req, obs)
+			}
+		})
+	}
+}
+
+// EncodeError records err for the observers before encoding it
+func (o *option) EncodeError(w http.ResponseWriter, err error) error {
+	if len(o.observers) > 0 {
+		if ow := findObservedWriter(w); ow != nil {
+			ow.err = err
+		}
+	}
+	return o.Codec.EncodeError(w, err)
+}
+
+// observedWriter records the status code and the body size of a response
+type observedWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+	err    error
+}
+
+func (w *observedWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *observedWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Unwrap returns the wrapped ResponseWriter for http.ResponseController
+func (w *observedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *observedWriter) Flush() {
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// findObservedWriter unwraps w until the observedWriter added by ObserveRoute
+func findObservedWriter(w http.ResponseWriter) *observedWriter {
+	for {
+		switch t := w.(type) {
+		case *observedWriter:
+			return t
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,35 @@
+package http
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/headless-go/nextgo/http/codec"
+)
+
+// PathPattern checks the raw value of a path parameter declared with a
+// constraint, e.g. Mapping.PathParam("id", "uuid"), before it is decoded.
+type PathPattern struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// NewPathPattern returns the PathPattern of the path parameter name, it panics
+// if pattern doesn't compile, generated handlers only use checked patterns.
+func NewPathPattern(name, pattern string) *PathPattern {
+	return &PathPattern{name: name, pattern: regexp.MustCompile(pattern)}
+}
+
+// Check returns a 400 Error with code INVALID_PATH_PARAM if the path parameter
+// of req doesn't match the pattern, the raw value is read with DecodePath of c
+// so that routers not filling Request.PathValue are supported
+func (p *PathPattern) Check(c codec.Codec, req *http.Request) error {
+	var value string
+	if err := c.DecodePath(req, p.name, &value); err != nil {
+		return err
+	}
+	if p.pattern.MatchString(value) {
+		return nil
+	}
+	return ErrBadRequest("INVALID_PATH_PARAM", "invalid path parameter %s: %q does not match %s", p.name, value, p.pattern)
+}
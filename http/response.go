@@ -0,0 +1,83 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/headless-go/nextgo/http/codec"
+)
+
+// Responder is implemented by handler results choosing their status code and
+// headers, the generated handler writes them before encoding the body.
+type Responder interface {
+	// ResponseStatus returns the status code, 0 keeps the status code of the route
+	ResponseStatus() int
+	ResponseHeader() http.Header
+	ResponseBody() any
+}
+
+// Response is a handler result carrying the status code and headers along the body.
+// Example:
+//
+//	func CreateTodo(ctx context.Context, req CreateTodoRequest) (*nhttp.Response[Todo], error) {
+//		return nhttp.NewResponse(http.StatusCreated, todo).WithHeader("Location", "/v1/todos/"+todo.ID), nil
+//	}
+type Response[T any] struct {
+	Status int
+	Header http.Header
+	Body   T
+}
+
+var _ Responder = (*Response[any])(nil)
+
+// NewResponse returns a Response with the status code and body
+func NewResponse[T any](status int, body T) *Response[T] {
+	return &Response[T]{Status: status, Body: body}
+}
+
+// WithHeader adds the header value to the response
+func (r *Response[T]) WithHeader(key, value string) *Response[T] {
+	if r.Header == nil {
+		r.Header = http.Header{}
+	}
+	r.Header.Add(key, value)
+	return r
+}
+
+func (r *Response[T]) ResponseStatus() int {
+	if r == nil {
+		return 0
+	}
+	return r.Status
+}
+
+func (r *Response[T]) ResponseHeader() http.Header {
+	if r == nil {
+		return nil
+	}
+	return r.Header
+}
+
+func (r *Response[T]) ResponseBody() any {
+	if r == nil {
+		return nil
+	}
+	return r.Body
+}
+
+// EncodeResponse encodes a handler result with the status code of the route,
+// a Responder sets the headers, the status code and the body itself.
+func EncodeResponse(c codec.Codec, w http.ResponseWriter, statusCode int, val any) error {
+	r, ok := val.(Responder)
+	if !ok {
+		return c.EncodeStatus(w, statusCode, val)
+	}
+	for key, values := range r.ResponseHeader() {
+		for _, v := range values {
+			w.Header().Add(key, v)
+		}
+	}
+	if status := r.ResponseStatus(); status != 0 {
+		statusCode = status
+	}
+	return c.EncodeStatus(w, statusCode, r.ResponseBody())
+}
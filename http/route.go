@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"slices"
+	"sync"
 
 	"github.com/headless-go/nextgo/http/codec"
 )
@@ -14,19 +16,38 @@ const (
 	routeinfoContextKey ctxKey = iota
 )
 
+// RouteInfo describes a generated route, the zero values of the decoded and
+// encoded types are given as examples for tooling
 type RouteInfo struct {
-	HTTPMethod      string
-	Method          string
-	Patten          string
-	Desc            string
-	Label           map[string]string
-	Middleware      []string
-	HandlerFuncPkg  string
+	HTTPMethod string
+	// Method is the method name of service handlers, empty for functions
+	Method string
+	Patten string
+	// PathPrefix is true for routes matching the paths below Patten
+	PathPrefix bool
+	Desc       string
+	Label      map[string]string
+	Middleware []string
+	// HandlerFuncPkg is the import path of the handler package
+	HandlerFuncPkg string
+	// HandlerFuncName is the handler function, or the service type of method handlers
 	HandlerFuncName string
-	HandleFunc      string
-	Response        []any
-	Request         []any
-	PathParam       []string
+	// HandleFunc is the qualified handler name as printed by runtime.FuncForPC,
+	// e.g. example.com/api/v1/notes.(*NoteService).Get
+	HandleFunc string
+	// StatusCode is the status code of successful responses
+	StatusCode int
+	// Response holds the response body type
+	Response []any
+	// Request holds the request body types
+	Request []any
+	// Query, Header, Cookie and Form hold the types bound with Mapping.BindQuery,
+	// BindHeader, BindCookie and BindForm
+	Query     []any
+	Header    []any
+	Cookie    []any
+	Form      []any
+	PathParam []string
 }
 
 func WithRouteInfo(r *RouteInfo) func(next http.Handler) http.Handler {
@@ -39,6 +60,12 @@ func WithRouteInfo(r *RouteInfo) func(next http.Handler) http.Handler {
 	}
 }
 
+// HasBody reports whether the request carries a body, generated handlers
+// leave pointer body args nil for requests without one
+func HasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody && req.ContentLength != 0
+}
+
 func RouteInfoFromContext(ctx context.Context) *RouteInfo {
 	r, _ := ctx.Value(routeinfoContextKey).(*RouteInfo)
 	return r
@@ -51,25 +78,53 @@ type Option interface {
 }
 
 var defaultLogRouterFunc = func(r RouteInfo) {
-	fmt.Printf("%s %s -> %s.%s.%s\n", r.HTTPMethod, r.Patten, r.HandlerFuncPkg, r.HandlerFuncName, r.Method)
+	fmt.Printf("%s %s -> %s\n", r.HTTPMethod, r.Patten, r.HandleFunc)
 }
 
 type option struct {
 	codec.Codec
 	Validator
+	mu             sync.RWMutex
 	routes         []RouteInfo
 	onRouteAddFunc []func(info RouteInfo)
+	introspection  *introspection
+	observers      []Observer
+	tracer         Tracer
 }
 
-func (o option) AddRoute(info RouteInfo) {
+func (o *option) AddRoute(info RouteInfo) {
+	o.mu.Lock()
+	o.routes = append(o.routes, info)
+	o.mu.Unlock()
 	for _, f := range o.onRouteAddFunc {
 		f(info)
 	}
 }
 
+// Routes returns the routes added to the option
+func (o *option) Routes() []RouteInfo {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return slices.Clone(o.routes)
+}
+
+// HandleOptionRoutes registers the endpoints served by the option itself, such
+// as the WithIntrospection endpoint, the generated Handle calls it after the
+// api routes. Options not created by NewDefaultOption serve none.
+func HandleOptionRoutes(svr Server, opt Option) {
+	o, ok := opt.(*option)
+	if !ok {
+		return
+	}
+	if o.introspection != nil {
+		svr.HandleFunc(http.MethodGet, o.introspection.pattern, o.introspection.handler(o).ServeHTTP)
+	}
+}
+
 func NewDefaultOption(opts ...OptionFunc) Option {
 
 	o := option{
+		Codec:          codec.New(),
 		Validator:      &validator{},
 		onRouteAddFunc: []func(info RouteInfo){defaultLogRouterFunc},
 	}
@@ -0,0 +1,66 @@
+// Package servemux adapts the standard library http.ServeMux (Go 1.22+) to the
+// nextgo http.Server interface, so generated APIs run without extra dependencies.
+//
+// Example:
+//
+//	svr := servemux.New()
+//	generated.Handle(svr)
+//	http.ListenAndServe(":8080", svr)
+package servemux
+
+import (
+	"net/http"
+	"strings"
+
+	nextgohttp "github.com/headless-go/nextgo/http"
+)
+
+// RestParam is the name of the wildcard that holds the remaining path of a prefix route
+const RestParam = "rest"
+
+var (
+	_ nextgohttp.PrefixServer = (*Server)(nil)
+	_ http.Handler            = (*Server)(nil)
+)
+
+// Server registers nextgo routes as `METHOD /path/{id}` patterns on a http.ServeMux
+type Server struct {
+	mux *http.ServeMux
+}
+
+// New returns a Server backed by a new http.ServeMux
+func New() *Server {
+	return NewWithMux(http.NewServeMux())
+}
+
+// NewWithMux returns a Server registering routes on the given http.ServeMux
+func NewWithMux(mux *http.ServeMux) *Server {
+	return &Server{mux: mux}
+}
+
+// HandleFunc registers the handler for the method and exact path
+func (s *Server) HandleFunc(method string, path string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern(method, path), handler)
+}
+
+// HandlePrefix registers the handler for the method and every path under prefix,
+// the remaining path is available as req.PathValue(RestParam)
+func (s *Server) HandlePrefix(method string, prefix string, handler http.HandlerFunc) {
+	if !strings.HasSuffix(prefix, "/") {
+		s.mux.HandleFunc(pattern(method, prefix), handler)
+		prefix += "/"
+	}
+	s.mux.HandleFunc(pattern(method, prefix+"{"+RestParam+"...}"), handler)
+}
+
+// ServeHTTP dispatches the request to the matched handler
+func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	s.mux.ServeHTTP(rw, req)
+}
+
+func pattern(method, path string) string {
+	if method == "" {
+		return path
+	}
+	return strings.ToUpper(method) + " " + path
+}
@@ -1,7 +1,27 @@
 package http
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+)
 
 type Server interface {
 	HandleFunc(method string, path string, handler http.HandlerFunc)
 }
+
+// PrefixServer is a Server supporting routes declared with Mapping.PathPrefix,
+// the handler serves the prefix and every path below it.
+type PrefixServer interface {
+	Server
+	HandlePrefix(method string, prefix string, handler http.HandlerFunc)
+}
+
+// HandlePrefix registers a PathPrefix route on svr, it panics if svr doesn't
+// implement PrefixServer rather than silently serving the exact path only.
+func HandlePrefix(svr Server, method string, prefix string, handler http.HandlerFunc) {
+	ps, ok := svr.(PrefixServer)
+	if !ok {
+		panic(fmt.Sprintf("nextgo: %T does not implement PrefixServer, cannot register PathPrefix route %s %s", svr, method, prefix))
+	}
+	ps.HandlePrefix(method, prefix, handler)
+}
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"context"
+	"net/http"
+)
+
+// Phase is a step of a generated handler traced in its own span
+type Phase string
+
+const (
+	// PhaseDecode covers DecodePath, Decode, DecodeQuery, DecodeHeader, DecodeCookie, DecodeForm and DecodeFile
+	PhaseDecode Phase = "decode"
+	// PhaseValidate covers Validator.Struct
+	PhaseValidate Phase = "validate"
+	// PhaseHandle covers the handler call, the context arg of the handler carries the span
+	PhaseHandle Phase = "handle"
+	// PhaseEncode covers encoding the response or the error
+	PhaseEncode Phase = "encode"
+)
+
+// Tracer starts the spans of the phases of generated handlers. Implementations
+// name spans with SpanName and set the route labels as attributes, e.g. backed
+// by OpenTelemetry:
+//
+//	func (t otelTracer) Start(ctx context.Context, route *http.RouteInfo, phase http.Phase) (context.Context, http.Span) {
+//		ctx, span := t.tracer.Start(ctx, http.SpanName(route, phase))
+//		for k, v := range route.Label {
+//			span.SetAttributes(attribute.String(k, v))
+//		}
+//		return ctx, otelSpan{span}
+//	}
+type Tracer interface {
+	// Start starts the span of phase, the returned context carries it
+	Start(ctx context.Context, route *RouteInfo, phase Phase) (context.Context, Span)
+}
+
+// Span is ended once the phase is done, err is the error of the phase if any
+type Span interface {
+	End(err error)
+}
+
+// WithTracer traces the phases of the generated handlers with t
+func WithTracer(t Tracer) OptionFunc {
+	return func(opt *option) {
+		opt.tracer = t
+	}
+}
+
+// SpanName returns the name of the span of a phase, e.g. "GET /v1/todos/{id} decode"
+func SpanName(route *RouteInfo, phase Phase) string {
+	return route.HTTPMethod + " " + route.Patten + " " + string(phase)
+}
+
+type noopTracer struct{}
+
+type noopSpan struct{}
+
+func (noopTracer) Start(ctx context.Context, _ *RouteInfo, _ Phase) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+func (noopSpan) End(error) {}
+
+// RouteTracer calls the codec and the validator of the option in spans of the
+// route, generated handlers create one per route. Without WithTracer it calls
+// them directly.
+type RouteTracer struct {
+	opt    Option
+	route  *RouteInfo
+	tracer Tracer
+}
+
+// NewRouteTracer returns the RouteTracer of route with the tracer of opt
+func NewRouteTracer(opt Option, route *RouteInfo) *RouteTracer {
+	t := &RouteTracer{opt: opt, route: route, tracer: noopTracer{}}
+	if o, ok := opt.(*option); ok && o.tracer != nil {
+		t.tracer = o.tracer
+	}
+	return t
+}
+
+// Start starts the span of phase
+func (t *RouteTracer) Start(ctx context.Context, phase Phase) (context.Context, Span) {
+	return t.tracer.Start(ctx, t.route, phase)
+}
+
+func (t *RouteTracer) end(span Span, err error) error {
+	span.End(err)
+	return err
+}
+
+func (t *RouteTracer) DecodePath(req *http.Request, name string, val any) error {
+	_, span := t.Start(req.Context(), PhaseDecode)
+	return t.end(span, t.opt.DecodePath(req, name, val))
+}
+
+func (t *RouteTracer) Decode(req *http.Request, val any) error {
+	_, span := t.Start(req.Context(), PhaseDecode)
+	return t.end(span, t.opt.Decode(req, val))
+}
+
+func (t *RouteTracer) DecodeQuery(req *http.Request, val any) error {
+	_, span := t.Start(req.Context(), PhaseDecode)
+	return t.end(span, t.opt.DecodeQuery(req, val))
+}
+
+func (t *RouteTracer) DecodeHeader(req *http.Request, val any) error {
+	_, span := t.Start(req.Context(), PhaseDecode)
+	return t.end(span, t.opt.DecodeHeader(req, val))
+}
+
+func (t *RouteTracer) DecodeCookie(req *http.Request, val any) error {
+	_, span := t.Start(req.Context(), PhaseDecode)
+	return t.end(span, t.opt.DecodeCookie(req, val))
+}
+
+func (t *RouteTracer) DecodeForm(req *http.Request, val any) error {
+	_, span := t.Start(req.Context(), PhaseDecode)
+	return t.end(span, t.opt.DecodeForm(req, val))
+}
+
+func (t *RouteTracer) DecodeFile(req *http.Request, name string, val any) error {
+	_, span := t.Start(req.Context(), PhaseDecode)
+	return t.end(span, t.opt.DecodeFile(req, name, val))
+}
+
+// Struct validates val with the Validator of the option, failures are
+// reported as a 422 Error with code VALIDATION_FAILED
+func (t *RouteTracer) Struct(req *http.Request, val any) error {
+	_, span := t.Start(req.Context(), PhaseValidate)
+	return t.end(span, validationError(t.opt.Struct(val)))
+}
+
+func (t *RouteTracer) EncodeError(req *http.Request, rw http.ResponseWriter, err error) error {
+	_, span := t.Start(req.Context(), PhaseEncode)
+	return t.end(span, t.opt.EncodeError(rw, err))
+}
+
+func (t *RouteTracer) EncodeStatus(req *http.Request, rw http.ResponseWriter, statusCode int, val any) error {
+	_, span := t.Start(req.Context(), PhaseEncode)
+	return t.end(span, t.opt.EncodeStatus(rw, statusCode, val))
+}
+
+// EncodeResponse encodes a handler result with EncodeResponse
+func (t *RouteTracer) EncodeResponse(req *http.Request, rw http.ResponseWriter, statusCode int, val any) error {
+	_, span := t.Start(req.Context(), PhaseEncode)
+	return t.end(span, EncodeResponse(t.opt, rw, statusCode, val))
+}
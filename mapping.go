@@ -18,6 +18,16 @@ type attrBase interface {
 	// ApiToken will be decode from header
 	BindHeader(...any) attrBase
 
+	// BindCookie binds HTTP cookies to a struct
+	// Example: BindCookie(Session{}) binds 'session_id' cookie
+	// Session will be decoded from cookie
+	BindCookie(...any) attrBase
+
+	// BindForm binds a multipart or url-encoded form body to a struct
+	// Example: BindForm(UploadRequest{}) binds 'title' and 'avatar' form fields
+	// UploadRequest will be decoded from form, *multipart.FileHeader fields hold the uploaded files
+	BindForm(...any) attrBase
+
 	// Middleware adds middleware functions to the request pipeline
 	// Example: Middleware(api.Auth) adds authentication middleware
 	Middleware(...string) attrBase
@@ -25,6 +35,15 @@ type attrBase interface {
 	// Label adds tags for a route
 	// Example: Label("code=CREATE_CLUSTER_APP", "auditlog.resource=CLUSTER_APP")
 	Label(...string) attrBase
+
+	// PathParam configures the path parameter name with a handler arg and a
+	// constraint, both optional. The arg decodes the parameter when its name
+	// differs, the generated handler responds 400 Bad Request to values not
+	// matching the constraint, one of uuid, date, int, uint, alpha, alnum and
+	// slug, or a regular expression starting with ^. Declared by MappingFile in
+	// middleware.go, it applies to the handlers of the directory and below.
+	// Example: PathParam("id", "uuid"), PathParam("todo_id", "id", "^[0-9]+$")
+	PathParam(name string, opts ...string) attrBase
 }
 
 // attr interface extends attrBase with HTTP-specific configurations
@@ -40,6 +59,10 @@ type attr interface {
 	// Example: StatusCode(http.StatusCreated) sets 201 status code
 	StatusCode(i int) attr
 
+	// Ignore excludes the function below from code generation, same as a
+	// //nextgo:ignore comment on the function
+	Ignore() attr
+
 	attrBase
 }
 
@@ -54,6 +77,30 @@ var Mapping = empty{}
 // MappingFile is used to define global API configurations in file scope
 var MappingFile = emptyBase{}
 
+// Service designates the receiver type whose exported methods are handlers in
+// the directory of the file. The generated Handle takes the instance as an
+// option named after the type.
+// Example:
+//
+//	var _ = nextgo.Service(TodoService{})
+//
+//	func (s *TodoService) Update(ctx context.Context, id string, req UpdateTodoItemRequest) error
+//
+// is served with api.Handle(svr, api.WithTodoService(svc))
+func Service(any) struct{} { return struct{}{} }
+
+// Provide declares provider functions for the directory of the file and its
+// subdirectories. A handler arg of the type a provider returns is supplied by
+// calling the provider, an error returned by the provider is encoded instead of
+// calling the handler. Providers are func() T, func(context.Context) T or
+// func(*http.Request) T, optionally returning (T, error).
+// Example:
+//
+//	var _ = nextgo.Provide(auth.CurrentPrincipal, logging.FromContext)
+//
+//	func Whoami(ctx context.Context, user *auth.Principal) (*Profile, error)
+func Provide(...any) struct{} { return struct{}{} }
+
 // empty is a no-op implementation used for compile-time API definition checks
 type empty struct{ emptyBase }
 
@@ -62,8 +109,12 @@ type emptyBase struct{}
 func (n empty) HttpMethod(string) attr { return n }
 func (n empty) PathPrefix() attr       { return n }
 func (n empty) StatusCode(int) attr    { return n }
+func (n empty) Ignore() attr           { return n }
 
-func (n emptyBase) Middleware(...string) attrBase { return n }
-func (n emptyBase) Label(...string) attrBase      { return n }
-func (n emptyBase) BindQuery(...any) attrBase     { return n }
-func (n emptyBase) BindHeader(...any) attrBase    { return n }
+func (n emptyBase) Middleware(...string) attrBase        { return n }
+func (n emptyBase) Label(...string) attrBase             { return n }
+func (n emptyBase) BindQuery(...any) attrBase            { return n }
+func (n emptyBase) BindHeader(...any) attrBase           { return n }
+func (n emptyBase) BindCookie(...any) attrBase           { return n }
+func (n emptyBase) BindForm(...any) attrBase             { return n }
+func (n emptyBase) PathParam(string, ...string) attrBase { return n }